@@ -1,12 +1,15 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+	"github.com/M1keTrike/LaundryAPI_Go/internal/stream"
 	"github.com/gin-gonic/gin"
 )
 
@@ -14,10 +17,6 @@ const (
 	MaxEnergySupplyPerSecond = 10 // Máxima energía suministrada por segundo
 )
 
-type EnergyBlock struct {
-	Energy int `json:"energy"`
-}
-
 func supplyEnergy(c *gin.Context) {
 	quantityStr := c.Query("quantity")
 	if quantityStr == "" {
@@ -37,31 +36,28 @@ func supplyEnergy(c *gin.Context) {
 		numBlocks++
 	}
 
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.Header().Set("Transfer-Encoding", "chunked")
-	c.Writer.WriteHeader(http.StatusOK)
-
-	for i := 0; i < numBlocks; i++ {
-		energyToSupply := MaxEnergySupplyPerSecond
-		if quantity < MaxEnergySupplyPerSecond {
-			energyToSupply = quantity
-		}
-		quantity -= energyToSupply
-
-		energyBlock := EnergyBlock{Energy: energyToSupply}
-		blockJSON, _ := json.Marshal(energyBlock)
-		_, err := c.Writer.Write([]byte(string(blockJSON) + "\n"))
-		if err != nil {
-			fmt.Println("Error enviando bloque de energía:", err)
-			break
-		}
-		c.Writer.Flush()
-		time.Sleep(1 * time.Second) // Simular envío de bloques de energía por segundo
+	remaining := quantity
+	summary := stream.Serve(c.Request.Context(), c.Writer, stream.Energy, quantity, numBlocks, 1*time.Second,
+		func(context.Context, int) (int, stream.Reason) {
+			energyToSupply := MaxEnergySupplyPerSecond
+			if remaining < MaxEnergySupplyPerSecond {
+				energyToSupply = remaining
+			}
+			remaining -= energyToSupply
+			return energyToSupply, ""
+		})
+	if summary.Reason != stream.ReasonCompleted {
+		fmt.Printf("Suministro de energía interrumpido (%s): %d de %d unidades\n", summary.Reason, summary.Delivered, summary.Requested)
 	}
 }
 
 func main() {
+	if err := clock.Setup(); err != nil {
+		log.Fatalf("Configuración del reloj inválida: %v", err)
+	}
+
 	r := gin.Default()
+	clock.RegisterRoutes(r)
 
 	r.GET("/supply", supplyEnergy)
 
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FleetConfigEnv         = "DRYER_FLEET_CONFIG" // Ruta del archivo YAML con la flota
+	DefaultFleetConfigPath = "dryers.yaml"
+)
+
+// DryerConfig describe una secadora de la flota. Los campos en cero toman el
+// valor de la sección defaults del archivo.
+type DryerConfig struct {
+	Name           string        `yaml:"name" json:"name"`
+	MaxEnergy      int           `yaml:"max_energy" json:"max_energy"`
+	EnergyPerCycle int           `yaml:"energy_per_cycle" json:"energy_per_cycle"`
+	CycleDuration  time.Duration `yaml:"cycle_duration" json:"-"`
+	CapacityKg     float64       `yaml:"capacity_kg" json:"capacity_kg"`
+}
+
+// FleetConfig es el contenido del archivo de configuración de la flota
+type FleetConfig struct {
+	Defaults DryerConfig   `yaml:"defaults"`
+	Dryers   []DryerConfig `yaml:"dryers"`
+}
+
+func builtinDefaults() DryerConfig {
+	return DryerConfig{
+		MaxEnergy:      MaxEnergyPerDryer,
+		EnergyPerCycle: EnergyPerCycle,
+		CycleDuration:  CycleDuration,
+		CapacityKg:     DefaultCapacityKg,
+	}
+}
+
+// builtinFleet se usa cuando no hay archivo de configuración
+func builtinFleet() FleetConfig {
+	return FleetConfig{
+		Dryers: []DryerConfig{{Name: "dryer1"}, {Name: "dryer2"}},
+	}
+}
+
+// withDefaults completa los campos vacíos con los de defaults
+func (c DryerConfig) withDefaults(defaults DryerConfig) DryerConfig {
+	if c.MaxEnergy == 0 {
+		c.MaxEnergy = defaults.MaxEnergy
+	}
+	if c.EnergyPerCycle == 0 {
+		c.EnergyPerCycle = defaults.EnergyPerCycle
+	}
+	if c.CycleDuration == 0 {
+		c.CycleDuration = defaults.CycleDuration
+	}
+	if c.CapacityKg == 0 {
+		c.CapacityKg = defaults.CapacityKg
+	}
+	return c
+}
+
+func (c DryerConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("la secadora necesita un nombre")
+	}
+	if c.MaxEnergy <= 0 || c.EnergyPerCycle <= 0 {
+		return fmt.Errorf("%s: max_energy y energy_per_cycle deben ser positivos", c.Name)
+	}
+	if c.EnergyPerCycle > c.MaxEnergy {
+		return fmt.Errorf("%s: energy_per_cycle no puede superar max_energy", c.Name)
+	}
+	if c.CycleDuration <= 0 {
+		return fmt.Errorf("%s: cycle_duration debe ser positivo", c.Name)
+	}
+	if c.CapacityKg <= 0 {
+		return fmt.Errorf("%s: capacity_kg debe ser positivo", c.Name)
+	}
+	return nil
+}
+
+// LoadFleetConfig lee la flota del archivo indicado en DRYER_FLEET_CONFIG o de
+// dryers.yaml. Si no se indicó archivo y no existe, usa la flota por defecto.
+func LoadFleetConfig() (FleetConfig, error) {
+	path := os.Getenv(FleetConfigEnv)
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFleetConfigPath
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		fmt.Printf("No se encontró %s; se usará la flota por defecto\n", path)
+		return builtinFleet(), nil
+	}
+	if err != nil {
+		return FleetConfig{}, err
+	}
+
+	var config FleetConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return FleetConfig{}, fmt.Errorf("%s: %v", path, err)
+	}
+	fmt.Printf("Flota cargada de %s: %d secadoras\n", path, len(config.Dryers))
+	return config, nil
+}
+
+// Fleet es el conjunto de secadoras
+type Fleet struct {
+	mu     sync.RWMutex
+	dryers []*Dryer
+}
+
+func NewFleet(config FleetConfig) (*Fleet, error) {
+	defaults := config.Defaults.withDefaults(builtinDefaults())
+	f := &Fleet{}
+	for _, dryerConfig := range config.Dryers {
+		dryerConfig = dryerConfig.withDefaults(defaults)
+		if err := dryerConfig.validate(); err != nil {
+			return nil, err
+		}
+		for _, existing := range f.dryers {
+			if existing.name == dryerConfig.Name {
+				return nil, fmt.Errorf("la secadora %s está repetida", dryerConfig.Name)
+			}
+		}
+		f.dryers = append(f.dryers, newDryer(dryerConfig))
+	}
+	if len(f.dryers) == 0 {
+		return nil, fmt.Errorf("la flota no tiene secadoras")
+	}
+	return f, nil
+}
+
+var fleet *Fleet
+
+// All devuelve una copia de la lista de secadoras
+func (f *Fleet) All() []*Dryer {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	dryers := make([]*Dryer, len(f.dryers))
+	copy(dryers, f.dryers)
+	return dryers
+}
+
+// Reserve marca como ocupada la primera secadora libre donde quepa la carga. Con
+// weightKg en cero la carga ocupa la secadora completa y cualquiera sirve.
+func (f *Fleet) Reserve(weightKg float64) *Dryer {
+	for _, dryer := range f.All() {
+		dryer.mu.Lock()
+		if !dryer.busy && weightKg <= dryer.capacityKg {
+			dryer.busy = true
+			dryer.mu.Unlock()
+			return dryer
+		}
+		dryer.mu.Unlock()
+	}
+	return nil
+}
+
+// MaxLoadKg devuelve la mayor carga en kg que admite alguna secadora de la flota
+func (f *Fleet) MaxLoadKg() float64 {
+	maxKg := 0.0
+	for _, dryer := range f.All() {
+		if dryer.capacityKg > maxKg {
+			maxKg = dryer.capacityKg
+		}
+	}
+	return maxKg
+}
+
+// Capacity cuenta las secadoras y cuántas están libres en este momento
+func (f *Fleet) Capacity() (total int, available int) {
+	for _, dryer := range f.All() {
+		dryer.mu.Lock()
+		total++
+		if !dryer.busy {
+			available++
+		}
+		dryer.mu.Unlock()
+	}
+	return total, available
+}
+
+// DryerInfo es la vista de una secadora en GET /dryers
+type DryerInfo struct {
+	DryerConfig
+	CycleSeconds float64 `json:"cycle_seconds"`
+	EnergyLevel  int     `json:"energy_level"`
+	Busy         bool    `json:"busy"`
+}
+
+func (d *Dryer) info() DryerInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return DryerInfo{
+		DryerConfig: DryerConfig{
+			Name:           d.name,
+			MaxEnergy:      d.maxEnergy,
+			EnergyPerCycle: d.energyPerCycle,
+			CycleDuration:  d.cycleDuration,
+			CapacityKg:     d.capacityKg,
+		},
+		CycleSeconds: d.cycleDuration.Seconds(),
+		EnergyLevel:  d.energyLevel,
+		Busy:         d.busy,
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+// JobRetention es lo que se conserva un trabajo terminado antes de descartarlo
+const JobRetention = 1 * time.Hour
+
+// JobPhase es la etapa en la que se encuentra un trabajo de secado
+type JobPhase string
+
+const (
+	PhaseHeating JobPhase = "heating" // La secadora está obteniendo energía
+	PhaseDrying  JobPhase = "drying"
+	PhaseDone    JobPhase = "done"
+	PhaseFailed  JobPhase = "failed"
+	PhaseAborted JobPhase = "aborted"
+)
+
+// Terminal indica si el trabajo ya no cambiará de etapa
+func (p JobPhase) Terminal() bool {
+	return p == PhaseDone || p == PhaseFailed || p == PhaseAborted
+}
+
+type DryJob struct {
+	ID         string     `json:"id"`
+	LoadType   int        `json:"load_type"`
+	WeightKg   float64    `json:"weight_kg,omitempty"` // Carga total; cero si no se indicó
+	Dryer      string     `json:"dryer"`
+	Phase      JobPhase   `json:"phase"`
+	Message    string     `json:"message,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"` // Inicio del ciclo de secado
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	abort chan struct{}
+}
+
+// JobRegistry guarda los trabajos de secado creados por POST /jobs. Como en las
+// lavadoras, los IDs llevan un prefijo de arranque para no repetirse al reiniciar.
+type JobRegistry struct {
+	mu     sync.Mutex
+	jobs   map[string]*DryJob
+	boot   string
+	nextID int
+}
+
+func NewJobRegistry() *JobRegistry {
+	boot := strconv.FormatInt(time.Now().UnixNano(), 36)
+	return &JobRegistry{jobs: map[string]*DryJob{}, boot: boot}
+}
+
+var jobs = NewJobRegistry()
+
+// Create registra un nuevo trabajo asignado a la secadora indicada
+func (r *JobRegistry) Create(loadType int, weightKg float64, dryer *Dryer) *DryJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	now := clock.Now()
+	job := &DryJob{
+		ID:        fmt.Sprintf("dry-%s-%d", r.boot, r.nextID),
+		LoadType:  loadType,
+		WeightKg:  weightKg,
+		Dryer:     dryer.name,
+		Phase:     PhaseHeating,
+		CreatedAt: now,
+		UpdatedAt: now,
+		abort:     make(chan struct{}),
+	}
+	r.jobs[job.ID] = job
+	return job
+}
+
+// Get devuelve una copia del trabajo para que pueda serializarse sin bloqueo
+func (r *JobRegistry) Get(id string) (DryJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return DryJob{}, false
+	}
+	return *job, true
+}
+
+// Aborted devuelve el canal que se cierra cuando se pide abortar el trabajo
+func (r *JobRegistry) Aborted(id string) <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[id]; ok {
+		return job.abort
+	}
+	return nil
+}
+
+// Abort pide detener un trabajo en curso. aborted es false si ya había terminado.
+func (r *JobRegistry) Abort(id string) (found bool, aborted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return false, false
+	}
+	if job.Phase.Terminal() {
+		return true, false
+	}
+	select {
+	case <-job.abort:
+	default:
+		close(job.abort)
+	}
+	return true, true
+}
+
+// StartDrying marca el inicio del ciclo de secado
+func (r *JobRegistry) StartDrying(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[id]; ok && !job.Phase.Terminal() {
+		now := clock.Now()
+		job.Phase = PhaseDrying
+		job.StartedAt = &now
+		job.UpdatedAt = now
+	}
+}
+
+// Complete marca el trabajo como terminado con éxito
+func (r *JobRegistry) Complete(id string, message string) {
+	r.finish(id, PhaseDone, message, "")
+}
+
+// Fail marca el trabajo como fallido
+func (r *JobRegistry) Fail(id string, reason string) {
+	r.finish(id, PhaseFailed, "", reason)
+}
+
+// MarkAborted cierra el trabajo después de que la secadora atendió la señal de aborto
+func (r *JobRegistry) MarkAborted(id string) {
+	r.finish(id, PhaseAborted, "", "Trabajo abortado por el cliente")
+}
+
+func (r *JobRegistry) finish(id string, phase JobPhase, message, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok || job.Phase.Terminal() {
+		return
+	}
+	now := clock.Now()
+	job.Phase = phase
+	job.Message = message
+	job.Error = reason
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	clock.AfterFunc(JobRetention, func() { r.forget(id) })
+}
+
+// forget descarta un trabajo terminado cuando vence su retención
+func (r *JobRegistry) forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[id]; ok && job.Phase.Terminal() {
+		delete(r.jobs, id)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+	"github.com/M1keTrike/LaundryAPI_Go/internal/stream"
+	"github.com/gin-gonic/gin"
+)
+
+type Dryer struct {
+	name           string
+	maxEnergy      int
+	energyPerCycle int
+	cycleDuration  time.Duration
+	capacityKg     float64
+	energyLevel    int
+	mu             sync.Mutex
+	busy           bool
+}
+
+const (
+	MaxEnergyPerDryer  = 100
+	EnergyPerCycle     = 40
+	CycleDuration      = 4 * time.Second
+	DefaultCapacityKg  = 8
+	EnergyServerSupply = "http://localhost:4008/supply?quantity=" // URL del proveedor de energía
+)
+
+func newDryer(config DryerConfig) *Dryer {
+	return &Dryer{
+		name:           config.Name,
+		maxEnergy:      config.MaxEnergy,
+		energyPerCycle: config.EnergyPerCycle,
+		cycleDuration:  config.CycleDuration,
+		capacityKg:     config.CapacityKg,
+		energyLevel:    config.MaxEnergy,
+	}
+}
+
+func (d *Dryer) release() {
+	d.mu.Lock()
+	d.busy = false
+	d.mu.Unlock()
+}
+
+// refillEnergy pide energía a cfe hasta llenar la secadora. Bloquea mientras
+// llegan los bloques, uno por segundo, o hasta que se cancele ctx.
+func (d *Dryer) refillEnergy(ctx context.Context) error {
+	d.mu.Lock()
+	needed := d.maxEnergy - d.energyLevel
+	d.mu.Unlock()
+	if needed <= 0 {
+		return nil
+	}
+
+	fmt.Printf("%s está recargando %d unidades de energía...\n", d.name, needed)
+	summary, err := stream.Fetch(ctx, http.MethodGet, EnergyServerSupply+strconv.Itoa(needed), stream.Energy, func(block stream.Block) error {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.energyLevel += block.Amount
+		if d.energyLevel > d.maxEnergy {
+			d.energyLevel = d.maxEnergy
+		}
+		fmt.Printf("%s recibió %d unidades de energía. Nivel actual: %d\n", d.name, block.Amount, d.energyLevel)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s no pudo obtener energía del proveedor: %v", d.name, err)
+	}
+	if summary.Reason != stream.ReasonCompleted {
+		fmt.Printf("%s recibió %d de %d unidades de energía (%s)\n", d.name, summary.Delivered, summary.Requested, summary.Reason)
+	}
+	return nil
+}
+
+// useEnergy descuenta la energía de un ciclo; recarga antes si no alcanza
+func (d *Dryer) useEnergy(ctx context.Context) error {
+	d.mu.Lock()
+	enough := d.energyLevel >= d.energyPerCycle
+	d.mu.Unlock()
+
+	if !enough {
+		if err := d.refillEnergy(ctx); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.energyLevel < d.energyPerCycle {
+		return fmt.Errorf("%s no tiene suficiente energía para el ciclo", d.name)
+	}
+	d.energyLevel -= d.energyPerCycle
+	fmt.Printf("%s utilizó %d unidades de energía. Nivel restante: %d\n", d.name, d.energyPerCycle, d.energyLevel)
+	return nil
+}
+
+func manageDrying(job *DryJob, dryer *Dryer) {
+	defer dryer.release()
+
+	// Abortar el trabajo corta también la recarga de energía en curso
+	abort := jobs.Aborted(job.ID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-abort:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := dryer.useEnergy(ctx); err != nil && ctx.Err() == nil {
+		fmt.Println(err)
+		jobs.Fail(job.ID, err.Error())
+		return
+	}
+
+	select {
+	case <-abort:
+		fmt.Printf("%s abortó el trabajo %s antes de secar\n", dryer.name, job.ID)
+		jobs.MarkAborted(job.ID)
+		return
+	default:
+	}
+
+	jobs.StartDrying(job.ID)
+	fmt.Printf("%s comenzó el ciclo de secado con carga tipo %d\n", dryer.name, job.LoadType)
+
+	cycle := clock.NewTimer(dryer.cycleDuration)
+	defer cycle.Stop()
+	select {
+	case <-cycle.C:
+		fmt.Printf("%s terminó el ciclo de secado\n", dryer.name)
+	case <-abort:
+		fmt.Printf("%s abortó el ciclo de secado del trabajo %s\n", dryer.name, job.ID)
+		jobs.MarkAborted(job.ID)
+		return
+	}
+
+	jobs.Complete(job.ID, fmt.Sprintf("Secadora %s completó el ciclo de secado con carga tipo %d", dryer.name, job.LoadType))
+}
+
+func main() {
+	if err := clock.Setup(); err != nil {
+		log.Fatalf("Configuración del reloj inválida: %v", err)
+	}
+
+	config, err := LoadFleetConfig()
+	if err != nil {
+		log.Fatalf("No se pudo leer la configuración de la flota: %v", err)
+	}
+	fleet, err = NewFleet(config)
+	if err != nil {
+		log.Fatalf("Configuración de flota inválida: %v", err)
+	}
+
+	r := gin.Default()
+	clock.RegisterRoutes(r)
+
+	r.GET("/capacity", func(c *gin.Context) {
+		total, available := fleet.Capacity()
+		c.JSON(http.StatusOK, gin.H{
+			"total":     total,
+			"available": available,
+			"max_kg":    fleet.MaxLoadKg(),
+		})
+	})
+
+	r.GET("/dryers", func(c *gin.Context) {
+		dryers := fleet.All()
+		infos := make([]DryerInfo, len(dryers))
+		for i, dryer := range dryers {
+			infos[i] = dryer.info()
+		}
+		c.JSON(http.StatusOK, infos)
+	})
+
+	// Crea un trabajo de secado y responde de inmediato con su ID
+	r.POST("/jobs", func(c *gin.Context) {
+		loadType, err := strconv.Atoi(c.Query("load"))
+		if err != nil || loadType < 1 || loadType > 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'load' debe ser 1, 2 o 3"})
+			return
+		}
+
+		// Sin 'kg' la carga ocupa la secadora completa
+		weightKg := 0.0
+		if weightStr := c.Query("kg"); weightStr != "" {
+			weightKg, err = strconv.ParseFloat(weightStr, 64)
+			if err != nil || weightKg <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'kg' debe ser un número positivo"})
+				return
+			}
+		}
+		if maxKg := fleet.MaxLoadKg(); weightKg > maxKg {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("La carga de %.1f kg supera la capacidad de las secadoras (%.1f kg)", weightKg, maxKg), "max_kg": maxKg})
+			return
+		}
+
+		dryer := fleet.Reserve(weightKg)
+		if dryer == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "No hay secadoras disponibles"})
+			return
+		}
+
+		job := jobs.Create(loadType, weightKg, dryer)
+		go manageDrying(job, dryer)
+
+		snapshot, _ := jobs.Get(job.ID)
+		c.JSON(http.StatusAccepted, snapshot)
+	})
+
+	// Consulta la etapa de un trabajo de secado
+	r.GET("/jobs/:id", func(c *gin.Context) {
+		job, ok := jobs.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trabajo no encontrado"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	})
+
+	// Aborta un trabajo en curso; la secadora queda libre en cuanto atiende la señal
+	r.DELETE("/jobs/:id", func(c *gin.Context) {
+		found, aborted := jobs.Abort(c.Param("id"))
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trabajo no encontrado"})
+			return
+		}
+		job, _ := jobs.Get(c.Param("id"))
+		if !aborted {
+			c.JSON(http.StatusConflict, gin.H{"error": "El trabajo ya terminó", "job": job})
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	})
+
+	// Ejecutar el servidor en el puerto 4009
+	r.Run(":4009")
+}
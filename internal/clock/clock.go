@@ -0,0 +1,264 @@
+// Package clock es el reloj compartido de la simulación. Todos los servicios miden
+// las duraciones simuladas (ciclos de lavado, bloques de agua y energía, esperas y
+// reintentos) con este reloj en lugar de usar time directamente, para poder
+// acelerar la simulación o avanzarla a mano en las pruebas.
+//
+// El reloj se configura por entorno con Setup:
+//
+//	SIM_CLOCK_SPEED  multiplicador de velocidad; 60 simula un minuto por segundo (por defecto 1)
+//	SIM_CLOCK_MODE   "manual" detiene el reloj; solo avanza con Advance o POST /clock/advance
+//	SIM_CLOCK_START  hora simulada inicial en RFC 3339 (por defecto la hora real)
+//	SIM_CLOCK_EPOCH  instante real, en RFC 3339, en que el reloj marca SIM_CLOCK_START
+//	                 (por defecto el arranque del proceso)
+//
+// Cada servicio tiene su propio reloj. Para que marquen la misma hora simulada
+// basta con darles los mismos valores de SIM_CLOCK_START y SIM_CLOCK_EPOCH.
+package clock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SpeedEnv = "SIM_CLOCK_SPEED"
+	ModeEnv  = "SIM_CLOCK_MODE"
+	StartEnv = "SIM_CLOCK_START"
+	EpochEnv = "SIM_CLOCK_EPOCH"
+
+	ModeScaled = "scaled" // Avanza con el tiempo real multiplicado por la velocidad
+	ModeManual = "manual" // Solo avanza cuando se pide
+)
+
+var errNotManual = errors.New("el reloj no está en modo manual")
+
+// Clock es un reloj simulado. En modo escalado la hora simulada avanza speed veces
+// más rápido que la real; en modo manual solo avanza con Advance.
+type Clock struct {
+	mu        sync.Mutex
+	speed     float64
+	manual    bool
+	origin    time.Time // Hora simulada en el momento en que arrancó el reloj
+	realStart time.Time
+	current   time.Time // Hora simulada del modo manual
+	pending   []*Timer  // Temporizadores del modo manual que aún no vencen
+}
+
+// New crea un reloj que arranca en start y avanza speed veces más rápido que el real
+func New(speed float64, start time.Time) *Clock {
+	return NewAt(speed, start, time.Now())
+}
+
+// NewAt crea un reloj escalado que marcaba start en el instante real epoch
+func NewAt(speed float64, start time.Time, epoch time.Time) *Clock {
+	return &Clock{speed: speed, origin: start, realStart: epoch}
+}
+
+// NewManual crea un reloj detenido en start que solo avanza con Advance
+func NewManual(start time.Time) *Clock {
+	return &Clock{speed: 0, manual: true, origin: start, current: start}
+}
+
+// FromEnv construye el reloj a partir de las variables SIM_CLOCK_*
+func FromEnv() (*Clock, error) {
+	epoch := time.Now()
+	start, err := timeFromEnv(StartEnv, epoch)
+	if err != nil {
+		return nil, err
+	}
+	epoch, err = timeFromEnv(EpochEnv, epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode := os.Getenv(ModeEnv); mode {
+	case ModeManual:
+		return NewManual(start), nil
+	case "", ModeScaled:
+	default:
+		return nil, fmt.Errorf("%s debe ser %q o %q, no %q", ModeEnv, ModeScaled, ModeManual, mode)
+	}
+
+	speed := 1.0
+	if value := os.Getenv(SpeedEnv); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("%s debe ser un número positivo, no %q", SpeedEnv, value)
+		}
+		speed = parsed
+	}
+	return NewAt(speed, start, epoch), nil
+}
+
+func timeFromEnv(name string, fallback time.Time) (time.Time, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s debe ser una hora RFC 3339: %v", name, err)
+	}
+	return parsed, nil
+}
+
+// Now devuelve la hora simulada
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nowLocked()
+}
+
+func (c *Clock) nowLocked() time.Time {
+	if c.manual {
+		return c.current
+	}
+	return c.origin.Add(time.Duration(float64(time.Since(c.realStart)) * c.speed))
+}
+
+// Since devuelve el tiempo simulado transcurrido desde t
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Real convierte una duración simulada en el tiempo real que tarda en pasar. En
+// modo manual devuelve cero porque el tiempo no pasa por sí solo.
+func (c *Clock) Real(d time.Duration) time.Duration {
+	if c.manual {
+		return 0
+	}
+	return time.Duration(float64(d) / c.speed)
+}
+
+// Speed devuelve el multiplicador de velocidad; cero en modo manual
+func (c *Clock) Speed() float64 {
+	return c.speed
+}
+
+// Mode devuelve ModeScaled o ModeManual
+func (c *Clock) Mode() string {
+	if c.manual {
+		return ModeManual
+	}
+	return ModeScaled
+}
+
+// Sleep bloquea hasta que pase la duración simulada d
+func (c *Clock) Sleep(d time.Duration) {
+	<-c.NewTimer(d).C
+}
+
+// After devuelve un canal que recibe la hora simulada cuando pasa d
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C
+}
+
+// NewTimer equivale a time.NewTimer con una duración simulada
+func (c *Clock) NewTimer(d time.Duration) *Timer {
+	ch := make(chan time.Time, 1)
+	t := &Timer{C: ch, clock: c}
+	t.fire = func() {
+		select {
+		case ch <- c.Now():
+		default:
+		}
+	}
+	c.schedule(t, d)
+	return t
+}
+
+// AfterFunc equivale a time.AfterFunc con una duración simulada; f corre en su
+// propia gorutina
+func (c *Clock) AfterFunc(d time.Duration, f func()) *Timer {
+	t := &Timer{clock: c}
+	t.fire = func() { go f() }
+	c.schedule(t, d)
+	return t
+}
+
+func (c *Clock) schedule(t *Timer, d time.Duration) {
+	if !c.manual {
+		t.real = time.AfterFunc(c.Real(d), t.fire)
+		return
+	}
+
+	c.mu.Lock()
+	if d <= 0 {
+		c.mu.Unlock()
+		t.fire()
+		return
+	}
+	t.deadline = c.current.Add(d)
+	c.pending = append(c.pending, t)
+	c.mu.Unlock()
+}
+
+// Advance adelanta el reloj manual y dispara, en orden, los temporizadores que
+// vencen en ese lapso. Cada uno ve la hora en la que venció.
+func (c *Clock) Advance(d time.Duration) error {
+	if !c.manual {
+		return errNotManual
+	}
+
+	c.mu.Lock()
+	target := c.current.Add(d)
+	for {
+		next := -1
+		for i, t := range c.pending {
+			if !t.deadline.After(target) && (next < 0 || t.deadline.Before(c.pending[next].deadline)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		t := c.pending[next]
+		c.pending = append(c.pending[:next], c.pending[next+1:]...)
+		c.current = t.deadline
+		c.mu.Unlock()
+		t.fire()
+		c.mu.Lock()
+	}
+	c.current = target
+	c.mu.Unlock()
+	return nil
+}
+
+// Pending devuelve cuántos temporizadores esperan en el reloj manual
+func (c *Clock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// Timer es un temporizador medido en tiempo simulado
+type Timer struct {
+	C <-chan time.Time
+
+	clock    *Clock
+	fire     func()
+	real     *time.Timer // Temporizador real del modo escalado
+	deadline time.Time   // Vencimiento en el modo manual
+}
+
+// Stop detiene el temporizador. Devuelve false si ya había vencido o se había detenido.
+func (t *Timer) Stop() bool {
+	if t.real != nil {
+		return t.real.Stop()
+	}
+
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.pending {
+		if pending == t {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
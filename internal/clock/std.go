@@ -0,0 +1,65 @@
+package clock
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// std es el reloj del proceso. Corre a velocidad real hasta que main llama a Setup.
+var std = New(1, time.Now())
+
+// Setup configura el reloj del proceso desde el entorno. Debe llamarse al inicio
+// de main, antes de crear temporizadores.
+func Setup() error {
+	configured, err := FromEnv()
+	if err != nil {
+		return err
+	}
+	std = configured
+	return nil
+}
+
+// Default devuelve el reloj del proceso
+func Default() *Clock { return std }
+
+func Now() time.Time                             { return std.Now() }
+func Since(t time.Time) time.Duration            { return std.Since(t) }
+func Sleep(d time.Duration)                      { std.Sleep(d) }
+func After(d time.Duration) <-chan time.Time     { return std.After(d) }
+func NewTimer(d time.Duration) *Timer            { return std.NewTimer(d) }
+func AfterFunc(d time.Duration, f func()) *Timer { return std.AfterFunc(d, f) }
+
+// Status es la respuesta de GET /clock
+type Status struct {
+	Now     time.Time `json:"now"`
+	Mode    string    `json:"mode"`
+	Speed   float64   `json:"speed"`
+	Pending int       `json:"pending_timers"`
+}
+
+func status() Status {
+	return Status{Now: std.Now(), Mode: std.Mode(), Speed: std.Speed(), Pending: std.Pending()}
+}
+
+// RegisterRoutes expone el reloj del proceso: GET /clock lo consulta y, en modo
+// manual, POST /clock/advance?by=1h30m lo adelanta
+func RegisterRoutes(r gin.IRouter) {
+	r.GET("/clock", func(c *gin.Context) {
+		c.JSON(http.StatusOK, status())
+	})
+
+	r.POST("/clock/advance", func(c *gin.Context) {
+		by, err := time.ParseDuration(c.Query("by"))
+		if err != nil || by <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'by' debe ser una duración positiva, por ejemplo 90s o 1h"})
+			return
+		}
+		if err := std.Advance(by); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "clock": status()})
+			return
+		}
+		c.JSON(http.StatusOK, status())
+	})
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+// Producer devuelve la cantidad del bloque i (desde 0). Para terminar el flujo
+// devuelve el motivo; un motivo vacío significa que el bloque se envía. Puede
+// bloquear mientras espera el recurso, pero debe volver en cuanto ctx se cancele.
+type Producer func(ctx context.Context, i int) (amount int, stop Reason)
+
+// Serve responde con un flujo de hasta blocks bloques de resource, esperando
+// interval de tiempo simulado entre uno y otro. Se detiene antes si el
+// productor se agota o si ctx se cancela, normalmente porque el cliente se
+// desconectó. Siempre termina con el resumen, que también devuelve.
+func Serve(ctx context.Context, w http.ResponseWriter, resource Resource, requested int, blocks int, interval time.Duration, next Producer) Summary {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+
+	encoder := NewEncoder(w, resource, requested)
+	reason := produce(ctx, encoder, blocks, interval, next)
+	summary, _ := encoder.Close(reason)
+	return summary
+}
+
+func produce(ctx context.Context, encoder *Encoder, blocks int, interval time.Duration, next Producer) Reason {
+	for i := 0; i < blocks; i++ {
+		if i > 0 && !wait(ctx, interval) {
+			return ReasonCancelled
+		}
+		if ctx.Err() != nil {
+			return ReasonCancelled
+		}
+		amount, stop := next(ctx, i)
+		if stop != "" {
+			return stop
+		}
+		if err := encoder.Send(amount); err != nil {
+			return ReasonError
+		}
+	}
+	return ReasonCompleted
+}
+
+// wait espera la duración simulada d; devuelve false si ctx se cancela antes
+func wait(ctx context.Context, d time.Duration) bool {
+	timer := clock.NewTimer(d)
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	}
+}
+
+// Fetch pide un flujo y entrega cada bloque a onBlock. Si onBlock devuelve un
+// error, se deja de leer, se corta la conexión para que el productor se detenga y
+// se devuelve ese error. Si el flujo termina con error, el resumen devuelto cuenta
+// solo los bloques que onBlock aceptó.
+func Fetch(ctx context.Context, method string, url string, resource Resource, onBlock func(Block) error) (Summary, error) {
+	return FetchAs(ctx, "", method, url, resource, onBlock)
+}
+
+// FetchAs es Fetch identificándose ante el productor con la cabecera X-Consumer
+func FetchAs(ctx context.Context, consumer string, method string, url string, resource Resource, onBlock func(Block) error) (Summary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	received := Summary{Reason: ReasonError}
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return received, err
+	}
+	if consumer != "" {
+		req.Header.Set(ConsumerHeader, consumer)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return received, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return received, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	decoder := NewDecoder(resp.Body, resource)
+	for {
+		block, err := decoder.Next()
+		if err == io.EOF {
+			summary, _ := decoder.Summary()
+			return summary, nil
+		}
+		if err != nil {
+			return received, err
+		}
+		if err := onBlock(block); err != nil {
+			received.Reason = ReasonCancelled
+			return received, err
+		}
+		received.Blocks++
+		received.Delivered += block.Amount
+	}
+}
+
+// StatusError indica que el productor respondió con un estado distinto de 200
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return "estado inesperado: " + http.StatusText(e.StatusCode)
+}
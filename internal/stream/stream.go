@@ -0,0 +1,188 @@
+// Package stream es el protocolo con el que sapam, el tanque y cfe entregan agua y
+// energía por bloques. El cuerpo de la respuesta es NDJSON: una línea por bloque
+// con su número de secuencia y la cantidad bajo el nombre del recurso, y una línea
+// final con el resumen de la entrega:
+//
+//	{"seq":1,"water":10}
+//	{"seq":2,"water":10}
+//	{"summary":{"blocks":2,"delivered":20,"requested":30,"reason":"exhausted"}}
+//
+// Los productores escriben con Serve o con un Encoder y los consumidores leen con
+// Fetch o con un Decoder.
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// ContentType es el tipo de contenido de los flujos de bloques
+	ContentType = "application/x-ndjson"
+	// ConsumerHeader identifica a quien pide el flujo, p. ej. el nombre de la lavadora
+	ConsumerHeader = "X-Consumer"
+)
+
+// Resource es lo que transporta el flujo
+type Resource string
+
+const (
+	Water  Resource = "water"
+	Energy Resource = "energy"
+)
+
+// Reason indica por qué terminó el flujo
+type Reason string
+
+const (
+	ReasonCompleted Reason = "completed" // Se entregó todo lo pedido
+	ReasonExhausted Reason = "exhausted" // El productor se quedó sin recurso
+	ReasonQuota     Reason = "quota"     // El consumidor agotó su cuota
+	ReasonCancelled Reason = "cancelled" // El cliente se desconectó o el servicio se detuvo
+	ReasonError     Reason = "error"     // El productor no pudo seguir escribiendo
+)
+
+var (
+	// ErrTruncated indica que el flujo terminó sin la línea de resumen
+	ErrTruncated = errors.New("el flujo terminó sin resumen")
+	errSequence  = errors.New("bloque fuera de secuencia")
+)
+
+// Block es un bloque entregado
+type Block struct {
+	Seq    int
+	Amount int
+}
+
+// Summary es la línea final del flujo
+type Summary struct {
+	Blocks    int    `json:"blocks"`
+	Delivered int    `json:"delivered"`
+	Requested int    `json:"requested"`
+	Reason    Reason `json:"reason"`
+}
+
+type trailer struct {
+	Summary Summary `json:"summary"`
+}
+
+// Encoder escribe los bloques de un flujo y lo cierra con el resumen
+type Encoder struct {
+	w         io.Writer
+	resource  Resource
+	requested int
+	seq       int
+	delivered int
+}
+
+// NewEncoder crea un codificador para un flujo en el que se pidieron requested unidades
+func NewEncoder(w io.Writer, resource Resource, requested int) *Encoder {
+	return &Encoder{w: w, resource: resource, requested: requested}
+}
+
+// Send escribe un bloque y lo envía de inmediato si w admite Flush
+func (e *Encoder) Send(amount int) error {
+	resource, err := json.Marshal(e.resource)
+	if err != nil {
+		return err
+	}
+	line := fmt.Appendf(nil, `{"seq":%d,%s:%d}`, e.seq+1, resource, amount)
+	if err := e.writeLine(line); err != nil {
+		return err
+	}
+	e.seq++
+	e.delivered += amount
+	return nil
+}
+
+// Close escribe el resumen y lo devuelve. El resumen se devuelve aunque no se
+// haya podido escribir, por ejemplo si el cliente ya se desconectó.
+func (e *Encoder) Close(reason Reason) (Summary, error) {
+	summary := e.Summary(reason)
+	line, err := json.Marshal(trailer{Summary: summary})
+	if err != nil {
+		return summary, err
+	}
+	return summary, e.writeLine(line)
+}
+
+// Summary devuelve lo entregado hasta ahora con el motivo indicado
+func (e *Encoder) Summary(reason Reason) Summary {
+	return Summary{Blocks: e.seq, Delivered: e.delivered, Requested: e.requested, Reason: reason}
+}
+
+func (e *Encoder) writeLine(line []byte) error {
+	if _, err := e.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// Decoder lee los bloques de un flujo
+type Decoder struct {
+	r        *bufio.Reader
+	resource Resource
+	seq      int
+	summary  *Summary
+}
+
+func NewDecoder(r io.Reader, resource Resource) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), resource: resource}
+}
+
+// Next devuelve el siguiente bloque. Al llegar al resumen devuelve io.EOF; si el
+// cuerpo termina antes, devuelve ErrTruncated.
+func (d *Decoder) Next() (Block, error) {
+	if d.summary != nil {
+		return Block{}, io.EOF
+	}
+
+	line, err := d.r.ReadBytes('\n')
+	if errors.Is(err, io.EOF) && len(line) == 0 {
+		return Block{}, ErrTruncated
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Block{}, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return Block{}, fmt.Errorf("línea inválida: %v", err)
+	}
+	if raw, ok := fields["summary"]; ok {
+		var summary Summary
+		if err := json.Unmarshal(raw, &summary); err != nil {
+			return Block{}, fmt.Errorf("resumen inválido: %v", err)
+		}
+		d.summary = &summary
+		return Block{}, io.EOF
+	}
+
+	var block Block
+	if err := json.Unmarshal(fields["seq"], &block.Seq); err != nil {
+		return Block{}, fmt.Errorf("bloque sin secuencia: %v", err)
+	}
+	if err := json.Unmarshal(fields[string(d.resource)], &block.Amount); err != nil {
+		return Block{}, fmt.Errorf("bloque sin %s: %v", d.resource, err)
+	}
+	if block.Seq != d.seq+1 {
+		return Block{}, fmt.Errorf("%w: se esperaba %d y llegó %d", errSequence, d.seq+1, block.Seq)
+	}
+	d.seq = block.Seq
+	return block, nil
+}
+
+// Summary devuelve el resumen si ya se leyó
+func (d *Decoder) Summary() (Summary, bool) {
+	if d.summary == nil {
+		return Summary{}, false
+	}
+	return *d.summary, true
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Códigos de error legibles por máquina de la API /v1
+const (
+	CodeInvalidRequest    = "invalid_request"
+	CodeValidationFailed  = "validation_failed"
+	CodeOrderNotFound     = "order_not_found"
+	CodeInvalidTransition = "invalid_transition"
+	CodeOrderNotPending   = "order_not_pending"
+	CodeJobFinished       = "job_finished"
+	CodeQueueFull         = "queue_full"
+	CodeWasherUnavailable = "washer_unavailable"
+	CodeInternal          = "internal_error"
+)
+
+// CreateOrderRequest es el cuerpo de POST /v1/orders. Para compartir el ciclo con
+// otras órdenes (allow_mixing) hay que indicar el peso y la tela.
+type CreateOrderRequest struct {
+	LoadType    int     `json:"load_type" binding:"required,min=1,max=3"`
+	Program     string  `json:"program" binding:"omitempty,oneof=cotton delicate eco heavy quick"`
+	Priority    *int    `json:"priority" binding:"required,min=0,max=1000"`
+	WeightKg    float64 `json:"weight_kg" binding:"omitempty,gt=0,lte=100"`
+	Fabric      string  `json:"fabric" binding:"omitempty,oneof=cotton synthetic delicate wool denim"`
+	AllowMixing bool    `json:"allow_mixing"`
+}
+
+// UpdateOrderRequest es el cuerpo de PATCH /v1/orders/:id; los campos omitidos no cambian
+type UpdateOrderRequest struct {
+	LoadType    *int     `json:"load_type" binding:"omitempty,min=1,max=3"`
+	Program     *string  `json:"program" binding:"omitempty,oneof=cotton delicate eco heavy quick"`
+	Priority    *int     `json:"priority" binding:"omitempty,min=0,max=1000"`
+	WeightKg    *float64 `json:"weight_kg" binding:"omitempty,gt=0,lte=100"`
+	Fabric      *string  `json:"fabric" binding:"omitempty,oneof=cotton synthetic delicate wool denim"`
+	AllowMixing *bool    `json:"allow_mixing"`
+}
+
+// empty indica que la petición no trae ningún cambio
+func (r UpdateOrderRequest) empty() bool {
+	return r.LoadType == nil && r.Program == nil && r.Priority == nil &&
+		r.WeightKg == nil && r.Fabric == nil && r.AllowMixing == nil
+}
+
+// mixingErrors devuelve los campos que faltan para compartir el ciclo
+func mixingErrors(allowMixing bool, weightKg float64, fabric string) []FieldError {
+	if !allowMixing {
+		return nil
+	}
+	var missing []FieldError
+	if weightKg <= 0 {
+		missing = append(missing, FieldError{Field: "weight_kg", Rule: "required_if", Param: "allow_mixing true"})
+	}
+	if fabric == "" {
+		missing = append(missing, FieldError{Field: "fabric", Rule: "required_if", Param: "allow_mixing true"})
+	}
+	return missing
+}
+
+// MixingError indica que una orden quedaría marcada para compartir ciclo sin los
+// datos que eso requiere
+type MixingError struct {
+	Missing []FieldError
+}
+
+func (e *MixingError) Error() string {
+	return "allow_mixing requiere weight_kg y fabric"
+}
+
+// OrderResponse es la representación pública de una orden
+type OrderResponse struct {
+	ID              int               `json:"id"`
+	LoadType        int               `json:"load_type"`
+	Program         string            `json:"program,omitempty"`
+	ResolvedProgram string            `json:"resolved_program,omitempty"` // Programa que usa la lavadora
+	WeightKg        float64           `json:"weight_kg,omitempty"`
+	Fabric          string            `json:"fabric,omitempty"`
+	AllowMixing     bool              `json:"allow_mixing"`
+	SharedCycle     []int             `json:"shared_cycle,omitempty"`
+	Priority        int               `json:"priority"`
+	Status          OrderState        `json:"status"`
+	AssignedWasher  string            `json:"assigned_washer,omitempty"`
+	JobID           string            `json:"job_id,omitempty"`
+	WashStage       string            `json:"wash_stage,omitempty"`
+	StartTime       *time.Time        `json:"start_time,omitempty"`
+	EndTime         *time.Time        `json:"end_time,omitempty"`
+	Attempts        int               `json:"attempts"`
+	LastFailure     FailureKind       `json:"last_failure,omitempty"`
+	LastError       string            `json:"last_error,omitempty"`
+	NextAttemptAt   *time.Time        `json:"next_attempt_at,omitempty"`
+	Stages          []OrderStage      `json:"stages"`
+	History         []StateTransition `json:"history"`
+}
+
+func newOrderResponse(order LaundryOrder) OrderResponse {
+	response := OrderResponse{
+		ID:              order.ID,
+		LoadType:        order.LoadType,
+		Program:         order.Program,
+		ResolvedProgram: order.ResolvedProgram,
+		WeightKg:        order.WeightKg,
+		Fabric:          order.Fabric,
+		AllowMixing:     order.AllowMixing,
+		SharedCycle:     order.SharedCycle,
+		Priority:        order.Priority,
+		Status:          order.Status,
+		AssignedWasher:  order.AssignedWasher,
+		JobID:           order.JobID,
+		WashStage:       order.WashStage,
+		Attempts:        order.Attempts,
+		LastFailure:     order.LastFailure,
+		LastError:       order.LastError,
+		NextAttemptAt:   order.NextAttemptAt,
+		Stages:          order.Stages,
+		History:         order.History,
+	}
+	if !order.StartTime.IsZero() {
+		response.StartTime = &order.StartTime
+	}
+	if !order.EndTime.IsZero() {
+		response.EndTime = &order.EndTime
+	}
+	if response.Stages == nil {
+		response.Stages = []OrderStage{}
+	}
+	if response.History == nil {
+		response.History = []StateTransition{}
+	}
+	return response
+}
+
+func newOrderResponses(orders []LaundryOrder) []OrderResponse {
+	responses := make([]OrderResponse, len(orders))
+	for i, order := range orders {
+		responses[i] = newOrderResponse(order)
+	}
+	return responses
+}
+
+// OrderListResponse envuelve las listas de órdenes
+type OrderListResponse struct {
+	Count  int             `json:"count"`
+	Orders []OrderResponse `json:"orders"`
+}
+
+// QueueResponse es la respuesta de GET /v1/queue
+type QueueResponse struct {
+	QueueStatus
+	AgingInterval string       `json:"aging_interval"`
+	Orders        []QueueEntry `json:"orders"`
+}
+
+// WasherFaultNotification es el aviso que envía el servicio de lavadoras cuando
+// una falla interrumpe un trabajo
+type WasherFaultNotification struct {
+	Washer string `json:"washer" binding:"required"`
+	JobID  string `json:"job_id" binding:"required"`
+	Fault  string `json:"fault" binding:"required"`
+}
+
+// APIError es el sobre común de los errores de la API /v1
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+type errorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+// FieldError describe una regla de validación incumplida
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+func writeAPIError(c *gin.Context, status int, code string, message string, details any) {
+	c.AbortWithStatusJSON(status, errorEnvelope{Error: APIError{Code: code, Message: message, Details: details}})
+}
+
+// writeBindingError distingue un JSON mal formado de un cuerpo que no pasa la validación
+func writeBindingError(c *gin.Context, err error) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		writeAPIError(c, http.StatusBadRequest, CodeInvalidRequest, "El cuerpo de la petición no es un JSON válido", err.Error())
+		return
+	}
+
+	fields := make([]FieldError, len(validationErrors))
+	for i, fieldErr := range validationErrors {
+		fields[i] = FieldError{Field: fieldErr.Field(), Rule: fieldErr.Tag(), Param: fieldErr.Param()}
+	}
+	writeAPIError(c, http.StatusUnprocessableEntity, CodeValidationFailed, "La petición no pasó la validación", fields)
+}
+
+// capacityFieldErrors describe una carga que excede la capacidad como error de validación de weight_kg
+func capacityFieldErrors(err *CapacityError) []FieldError {
+	return []FieldError{{Field: "weight_kg", Rule: "lte", Param: strconv.FormatFloat(err.MaxKg, 'f', -1, 64)}}
+}
+
+// writeOrderError traduce los errores de las operaciones sobre órdenes
+func writeOrderError(c *gin.Context, err error, order LaundryOrder) {
+	var invalid *InvalidTransitionError
+	var overweight *CapacityError
+	var mixing *MixingError
+	switch {
+	case errors.As(err, &overweight):
+		writeAPIError(c, http.StatusUnprocessableEntity, CodeValidationFailed, err.Error(), capacityFieldErrors(overweight))
+	case errors.As(err, &mixing):
+		writeAPIError(c, http.StatusUnprocessableEntity, CodeValidationFailed, "La petición no pasó la validación", mixing.Missing)
+	case errors.Is(err, errOrderNotFound):
+		writeAPIError(c, http.StatusNotFound, CodeOrderNotFound, "Orden no encontrada", nil)
+	case errors.As(err, &invalid):
+		writeAPIError(c, http.StatusConflict, CodeInvalidTransition, err.Error(), newOrderResponse(order))
+	case errors.Is(err, errOrderNotPending):
+		writeAPIError(c, http.StatusConflict, CodeOrderNotPending, err.Error(), newOrderResponse(order))
+	case errors.Is(err, errJobFinished):
+		writeAPIError(c, http.StatusConflict, CodeJobFinished, err.Error(), newOrderResponse(order))
+	default:
+		writeAPIError(c, http.StatusBadGateway, CodeWasherUnavailable, err.Error(), newOrderResponse(order))
+	}
+}
+
+// orderIDParam lee el parámetro :id y responde con error si no es un entero
+func orderIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		writeAPIError(c, http.StatusBadRequest, CodeInvalidRequest, "ID inválido", nil)
+		return 0, false
+	}
+	return id, true
+}
+
+// useJSONFieldNames hace que los errores de validación usen los nombres del JSON
+// en lugar de los nombres de los campos de Go
+func useJSONFieldNames() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+// deprecated marca las rutas anteriores a /v1 e indica la ruta que las reemplaza
+func deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		c.Next()
+	}
+}
+
+// registerV1Routes monta la API versionada con cuerpos JSON
+func registerV1Routes(r *gin.Engine, ls *LaundryServer) {
+	useJSONFieldNames()
+
+	v1 := r.Group("/v1")
+
+	v1.POST("/orders", func(c *gin.Context) {
+		var request CreateOrderRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			writeBindingError(c, err)
+			return
+		}
+
+		if missing := mixingErrors(request.AllowMixing, request.WeightKg, request.Fabric); missing != nil {
+			writeAPIError(c, http.StatusUnprocessableEntity, CodeValidationFailed, "La petición no pasó la validación", missing)
+			return
+		}
+
+		order, err := ls.AddOrder(OrderSpec{
+			LoadType:    request.LoadType,
+			Program:     request.Program,
+			Priority:    *request.Priority,
+			WeightKg:    request.WeightKg,
+			Fabric:      request.Fabric,
+			AllowMixing: request.AllowMixing,
+		})
+		var overweight *CapacityError
+		if errors.As(err, &overweight) {
+			writeAPIError(c, http.StatusUnprocessableEntity, CodeValidationFailed, err.Error(), capacityFieldErrors(overweight))
+			return
+		}
+		if errors.Is(err, errQueueFull) {
+			retryAfter := ls.RetryAfter()
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			writeAPIError(c, http.StatusTooManyRequests, CodeQueueFull, "La cola de órdenes está llena, intente más tarde", gin.H{
+				"retry_after_seconds": retryAfter,
+				"queue":               ls.QueueStatus(),
+			})
+			return
+		}
+		if err != nil {
+			writeAPIError(c, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+			return
+		}
+
+		c.Header("Location", fmt.Sprintf("/v1/orders/%d", order.ID))
+		c.JSON(http.StatusCreated, newOrderResponse(order))
+	})
+
+	v1.GET("/orders", func(c *gin.Context) {
+		orders := newOrderResponses(ls.GetOrders())
+		c.JSON(http.StatusOK, OrderListResponse{Count: len(orders), Orders: orders})
+	})
+
+	v1.GET("/orders/failed", func(c *gin.Context) {
+		orders := newOrderResponses(ls.FailedOrders())
+		c.JSON(http.StatusOK, OrderListResponse{Count: len(orders), Orders: orders})
+	})
+
+	v1.GET("/orders/events", allOrderEventsHandler(ls))
+
+	v1.GET("/orders/:id", func(c *gin.Context) {
+		id, ok := orderIDParam(c)
+		if !ok {
+			return
+		}
+		order, found := ls.GetOrderByID(id)
+		if !found {
+			writeOrderError(c, errOrderNotFound, order)
+			return
+		}
+		c.JSON(http.StatusOK, newOrderResponse(order))
+	})
+
+	v1.PATCH("/orders/:id", func(c *gin.Context) {
+		id, ok := orderIDParam(c)
+		if !ok {
+			return
+		}
+
+		var request UpdateOrderRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			writeBindingError(c, err)
+			return
+		}
+		if request.empty() {
+			writeAPIError(c, http.StatusUnprocessableEntity, CodeValidationFailed, "Se requiere al menos un campo para modificar", nil)
+			return
+		}
+
+		order, err := ls.ModifyOrder(id, OrderChanges{
+			LoadType:    request.LoadType,
+			Program:     request.Program,
+			Priority:    request.Priority,
+			WeightKg:    request.WeightKg,
+			Fabric:      request.Fabric,
+			AllowMixing: request.AllowMixing,
+		})
+		if err != nil {
+			writeOrderError(c, err, order)
+			return
+		}
+		c.JSON(http.StatusOK, newOrderResponse(order))
+	})
+
+	v1.DELETE("/orders/:id", func(c *gin.Context) {
+		id, ok := orderIDParam(c)
+		if !ok {
+			return
+		}
+		order, err := ls.CancelOrder(id)
+		if err != nil {
+			writeOrderError(c, err, order)
+			return
+		}
+		c.JSON(http.StatusOK, newOrderResponse(order))
+	})
+
+	v1.POST("/orders/:id/retry", func(c *gin.Context) {
+		id, ok := orderIDParam(c)
+		if !ok {
+			return
+		}
+		order, err := ls.RetryOrder(id)
+		if err != nil {
+			writeOrderError(c, err, order)
+			return
+		}
+		c.JSON(http.StatusAccepted, newOrderResponse(order))
+	})
+
+	v1.GET("/orders/:id/events", orderEventsHandler(ls))
+
+	// Aviso del servicio de lavadoras; las órdenes afectadas se vuelven a despachar
+	v1.POST("/washer-faults", func(c *gin.Context) {
+		var notification WasherFaultNotification
+		if err := c.ShouldBindJSON(&notification); err != nil {
+			writeBindingError(c, err)
+			return
+		}
+		orders := ls.HandleWasherFault(notification.Washer, notification.JobID, notification.Fault)
+		if len(orders) == 0 {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.JSON(http.StatusAccepted, OrderListResponse{Count: len(orders), Orders: newOrderResponses(orders)})
+	})
+
+	v1.GET("/queue", func(c *gin.Context) {
+		c.JSON(http.StatusOK, QueueResponse{
+			QueueStatus:   ls.QueueStatus(),
+			AgingInterval: AgingInterval.String(),
+			Orders:        ls.queue.Snapshot(),
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+const (
+	QueueLimitEnv      = "LAUNDRY_QUEUE_LIMIT"
+	DefaultQueueLimit  = 100
+	DefaultServiceTime = 5 * time.Second // Estimación inicial de lo que tarda una orden en una lavadora
+	serviceTimeWeight  = 0.2             // Peso de cada muestra nueva en la media móvil
+)
+
+var errQueueFull = errors.New("la cola de órdenes está llena")
+
+// LoadQueueLimit lee el límite de la cola de LAUNDRY_QUEUE_LIMIT
+func LoadQueueLimit() int {
+	value := os.Getenv(QueueLimitEnv)
+	if value == "" {
+		return DefaultQueueLimit
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		fmt.Printf("Valor inválido en %s: %q. Se usará %d\n", QueueLimitEnv, value, DefaultQueueLimit)
+		return DefaultQueueLimit
+	}
+	return limit
+}
+
+// serviceTimeEstimator lleva una media móvil exponencial del tiempo que una orden
+// ocupa una lavadora, para estimar cuándo se liberará un lugar en la cola
+type serviceTimeEstimator struct {
+	mu      sync.Mutex
+	average time.Duration
+}
+
+func newServiceTimeEstimator() *serviceTimeEstimator {
+	return &serviceTimeEstimator{average: DefaultServiceTime}
+}
+
+func (e *serviceTimeEstimator) Observe(sample time.Duration) {
+	if sample <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.average = time.Duration(serviceTimeWeight*float64(sample) + (1-serviceTimeWeight)*float64(e.average))
+}
+
+func (e *serviceTimeEstimator) Average() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.average
+}
+
+// QueueStatus resume la profundidad de la cola y la espera estimada
+type QueueStatus struct {
+	Depth              int     `json:"depth"`
+	Limit              int     `json:"limit"`
+	Available          int     `json:"available"`
+	Workers            int     `json:"workers"`
+	AverageServiceSecs float64 `json:"average_service_seconds"`
+	EstimatedWaitSecs  float64 `json:"estimated_wait_seconds"`
+}
+
+// QueueStatus calcula la espera estimada suponiendo que los despachadores vacían
+// la cola en paralelo al ritmo de la duración media de una orden
+func (ls *LaundryServer) QueueStatus() QueueStatus {
+	depth := ls.queue.Len()
+	limit := ls.queue.Limit()
+	workers := ls.pool.Size()
+	if workers < 1 {
+		workers = 1
+	}
+	average := ls.serviceTime.Average()
+
+	available := limit - depth
+	if available < 0 {
+		available = 0
+	}
+	return QueueStatus{
+		Depth:              depth,
+		Limit:              limit,
+		Available:          available,
+		Workers:            ls.pool.Size(),
+		AverageServiceSecs: average.Seconds(),
+		EstimatedWaitSecs:  float64(depth) * average.Seconds() / float64(workers),
+	}
+}
+
+// RetryAfter estima cuántos segundos faltan para que se libere un lugar en la
+// cola: cada despachador saca una orden cada vez que termina la anterior.
+func (ls *LaundryServer) RetryAfter() int {
+	status := ls.QueueStatus()
+	workers := status.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	excess := status.Depth - status.Limit + 1
+	if excess < 1 {
+		excess = 1
+	}
+	simulated := time.Duration(float64(excess) * status.AverageServiceSecs / float64(workers) * float64(time.Second))
+	// El cliente espera en tiempo real; con el reloj acelerado la espera es menor
+	seconds := clock.Default().Real(simulated).Seconds()
+	return int(math.Max(1, math.Ceil(seconds)))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+const (
+	WorkerCountEnv      = "LAUNDRY_WORKERS" // Fija el tamaño del pool y desactiva el descubrimiento
+	DefaultWorkerCount  = 1
+	PoolRefreshInterval = 30 * time.Second
+)
+
+// DispatchPool mantiene un despachador por lavadora disponible en el servicio de lavadoras
+type DispatchPool struct {
+	ls        *LaundryServer
+	mu        sync.Mutex
+	stops     []chan struct{}
+	maxLoadKg map[string]float64 // Mayor carga por programa según el último descubrimiento
+	programs  map[int]string     // Programa que usa la lavadora para cada tipo de carga
+}
+
+func NewDispatchPool(ls *LaundryServer) *DispatchPool {
+	return &DispatchPool{ls: ls}
+}
+
+// Size devuelve el número de despachadores activos
+func (p *DispatchPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// Resize ajusta el número de despachadores. Un despachador que sobra termina
+// después de entregar la orden que tenga en curso.
+func (p *DispatchPool) Resize(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.stops) < n {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		go p.worker(len(p.stops), stop)
+	}
+	for len(p.stops) > n {
+		last := len(p.stops) - 1
+		close(p.stops[last])
+		p.stops = p.stops[:last]
+	}
+}
+
+// MaxLoadKg devuelve la mayor carga que admite alguna lavadora con el programa;
+// sin programa se usa el del tipo de carga. Cero si aún no se conoce.
+func (p *DispatchPool) MaxLoadKg(program string, loadType int) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.maxLoadKg[p.programLocked(program, loadType)]
+}
+
+// limitLoad corrige la carga máxima de un programa con la que informó la lavadora
+// al rechazar un ciclo, sin esperar al siguiente descubrimiento
+func (p *DispatchPool) limitLoad(program string, loadType int, maxKg float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.maxLoadKg == nil {
+		p.maxLoadKg = map[string]float64{}
+	}
+	p.maxLoadKg[p.programLocked(program, loadType)] = maxKg
+}
+
+func (p *DispatchPool) programLocked(program string, loadType int) string {
+	if program == "" {
+		return p.programs[loadType]
+	}
+	return program
+}
+
+func (p *DispatchPool) worker(id int, stop chan struct{}) {
+	fmt.Printf("Despachador %d iniciado\n", id)
+	for {
+		select {
+		case <-stop:
+			fmt.Printf("Despachador %d detenido\n", id)
+			return
+		default:
+		}
+
+		item := p.ls.queue.take()
+		select {
+		case <-stop:
+			// Se redujo el pool mientras esperaba: la orden queda para otro despachador
+			p.ls.queue.putBack(item)
+			fmt.Printf("Despachador %d detenido\n", id)
+			return
+		default:
+		}
+		p.ls.assignOrderToWasher(item.order)
+	}
+}
+
+// Run dimensiona el pool. Si el tamaño no está fijado por entorno, lo descubre
+// del servicio de lavadoras y lo vuelve a consultar periódicamente. La capacidad
+// en kg por programa se consulta siempre, porque la usan el armado de ciclos y la
+// validación del peso de las órdenes.
+func (p *DispatchPool) Run() {
+	fixed := false
+	if value := os.Getenv(WorkerCountEnv); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err == nil && workers > 0 {
+			fmt.Printf("Usando %d despachadores definidos en %s\n", workers, WorkerCountEnv)
+			p.Resize(workers)
+			fixed = true
+		} else {
+			fmt.Printf("Valor inválido en %s: %q. Se usará el descubrimiento automático\n", WorkerCountEnv, value)
+		}
+	}
+
+	if !fixed {
+		p.Resize(DefaultWorkerCount)
+	}
+	for {
+		capacity, err := discoverWasherCapacity(p.ls.washerURL)
+		if err != nil {
+			fmt.Printf("No se pudo consultar la capacidad del servicio de lavadoras: %v\n", err)
+		} else {
+			p.mu.Lock()
+			p.maxLoadKg = capacity.MaxKgByProgram
+			p.programs = capacity.LoadPrograms
+			p.mu.Unlock()
+			if !fixed && capacity.Total > 0 && capacity.Total != p.Size() {
+				fmt.Printf("El servicio de lavadoras reporta %d lavadoras. Ajustando despachadores\n", capacity.Total)
+				p.Resize(capacity.Total)
+			}
+		}
+		clock.Sleep(PoolRefreshInterval)
+	}
+}
+
+// washerCapacity es la respuesta de GET /capacity del servicio de lavadoras
+type washerCapacity struct {
+	Total          int                `json:"total"`
+	Available      int                `json:"available"`
+	MaxKg          float64            `json:"max_kg"`
+	MaxKgByProgram map[string]float64 `json:"max_kg_by_program"`
+	LoadPrograms   map[int]string     `json:"load_programs"`
+}
+
+// discoverWasherCapacity pregunta al servicio de lavadoras cuántas máquinas tiene
+// y cuánto carga la más grande con cada programa
+func discoverWasherCapacity(baseURL string) (washerCapacity, error) {
+	var capacity washerCapacity
+	resp, err := http.Get(baseURL + "/capacity")
+	if err != nil {
+		return capacity, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return capacity, fmt.Errorf("estado inesperado: %d", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&capacity)
+	return capacity, err
+}
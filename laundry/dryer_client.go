@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+const DryerServerURL = "http://localhost:4009"
+
+// dryJob refleja la respuesta de POST /jobs y GET /jobs/:id del servicio de secadoras
+type dryJob struct {
+	ID        string     `json:"id"`
+	LoadType  int        `json:"load_type"`
+	Dryer     string     `json:"dryer"`
+	Phase     string     `json:"phase"`
+	Message   string     `json:"message"`
+	Error     string     `json:"error"`
+	StartedAt *time.Time `json:"started_at"`
+}
+
+func (j *dryJob) finished() bool {
+	return j.Phase == "done" || j.Phase == "failed" || j.Phase == "aborted"
+}
+
+// submitDryJob crea un trabajo de secado. Igual que submitWashJob, con weightKg
+// en cero la carga ocupa la secadora completa, devuelve el código HTTP para
+// clasificar el fallo e indica en el error si la carga no cabe en ninguna secadora.
+func submitDryJob(baseURL string, loadType int, weightKg float64) (*dryJob, int, error) {
+	query := url.Values{"load": {strconv.Itoa(loadType)}}
+	if weightKg > 0 {
+		query.Set("kg", strconv.FormatFloat(weightKg, 'f', -1, 64))
+	}
+	resp, err := http.Post(baseURL+"/jobs?"+query.Encode(), "application/json", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		var rejection struct {
+			MaxKg float64 `json:"max_kg"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&rejection) == nil && rejection.MaxKg > 0 {
+			return nil, resp.StatusCode, fmt.Errorf("la carga de %.1f kg supera la capacidad de las secadoras (%.1f kg)", weightKg, rejection.MaxKg)
+		}
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, resp.StatusCode, fmt.Errorf("estado inesperado de las secadoras: %d", resp.StatusCode)
+	}
+
+	var job dryJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return &job, resp.StatusCode, nil
+}
+
+func fetchDryJob(baseURL string, id string) (*dryJob, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/jobs/%s", baseURL, id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errJobNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("estado inesperado: %d", resp.StatusCode)
+	}
+
+	var job dryJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// waitForDryJob consulta el trabajo de secado hasta que termine
+func waitForDryJob(baseURL string, id string) (*dryJob, error) {
+	failures := 0
+	for {
+		clock.Sleep(JobPollInterval)
+
+		job, err := fetchDryJob(baseURL, id)
+		if errors.Is(err, errJobNotFound) {
+			return nil, err
+		}
+		if err != nil {
+			failures++
+			if failures >= MaxPollErrors {
+				return nil, fmt.Errorf("no se pudo consultar el trabajo %s: %v", id, err)
+			}
+			continue
+		}
+		failures = 0
+
+		if job.finished() {
+			return job, nil
+		}
+	}
+}
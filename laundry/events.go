@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SubscriberBuffer  = 32
+	HeartbeatInterval = 15 * time.Second
+)
+
+// OrderEvent es una transición de estado publicada a los clientes SSE
+type OrderEvent struct {
+	Seq            uint64        `json:"seq"`
+	OrderID        int           `json:"order_id"`
+	PreviousStatus OrderState    `json:"previous_status,omitempty"`
+	Status         OrderState    `json:"status"`
+	Reason         string        `json:"reason,omitempty"`
+	Timestamp      time.Time     `json:"timestamp"`
+	Order          OrderResponse `json:"order"`
+}
+
+type subscriber struct {
+	orderID int // 0 recibe los eventos de todas las órdenes
+	events  chan OrderEvent
+}
+
+// EventBroker reparte las transiciones de las órdenes entre los clientes suscritos
+type EventBroker struct {
+	mu          sync.Mutex
+	seq         uint64
+	subscribers map[*subscriber]struct{}
+}
+
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscribers: map[*subscriber]struct{}{}}
+}
+
+func (b *EventBroker) Subscribe(orderID int) *subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscriber{orderID: orderID, events: make(chan OrderEvent, SubscriberBuffer)}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (b *EventBroker) Unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, sub)
+}
+
+// Publish entrega el evento sin bloquear: un cliente que no consume a tiempo pierde
+// el evento en lugar de frenar a los despachadores
+func (b *EventBroker) Publish(event OrderEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event.Seq = b.seq
+	for sub := range b.subscribers {
+		if sub.orderID != 0 && sub.orderID != event.OrderID {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			fmt.Printf("Cliente SSE lento: se descartó el evento %d de la orden ID %d\n", event.Seq, event.OrderID)
+		}
+	}
+}
+
+// openEventStream envía las cabeceras SSE de inmediato para que el cliente sepa que
+// la conexión quedó abierta aunque todavía no haya eventos
+func openEventStream(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
+
+// streamEvents transmite los eventos del suscriptor hasta que el cliente se desconecte.
+// Si stopOnFinal es verdadero, el flujo se cierra cuando la orden llega a un estado final.
+func streamEvents(c *gin.Context, broker *EventBroker, sub *subscriber, stopOnFinal bool) {
+	defer broker.Unsubscribe(sub)
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-heartbeat.C:
+			// Comentario SSE para mantener viva la conexión a través de proxies
+			_, err := w.Write([]byte(": ping\n\n"))
+			return err == nil
+		case event := <-sub.events:
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatUint(event.Seq, 10),
+				Event: "status",
+				Data:  event,
+			})
+			return !(stopOnFinal && event.Status.Terminal())
+		}
+	})
+}
+
+// orderEventsHandler atiende GET /order/:id/events
+func orderEventsHandler(ls *LaundryServer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := orderIDParam(c)
+		if !ok {
+			return
+		}
+
+		// Suscribirse antes de leer el estado para no perder una transición intermedia
+		sub := ls.events.Subscribe(id)
+		order, found := ls.GetOrderByID(id)
+		if !found {
+			ls.events.Unsubscribe(sub)
+			writeOrderError(c, errOrderNotFound, order)
+			return
+		}
+
+		openEventStream(c)
+
+		// El primer evento es el estado actual para que el cliente no tenga que consultarlo aparte
+		c.Render(-1, sse.Event{Event: "snapshot", Data: newOrderResponse(order)})
+		c.Writer.Flush()
+		if order.Status.Terminal() {
+			ls.events.Unsubscribe(sub)
+			return
+		}
+
+		streamEvents(c, ls.events, sub, true)
+	}
+}
+
+// allOrderEventsHandler atiende GET /orders/events
+func allOrderEventsHandler(ls *LaundryServer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub := ls.events.Subscribe(0)
+		openEventStream(c)
+		streamEvents(c, ls.events, sub, false)
+	}
+}
@@ -1,25 +1,41 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
 	"github.com/gin-gonic/gin"
 )
 
 type LaundryOrder struct {
-	ID             int
-	LoadType       int
-	StartTime      time.Time
-	EndTime        time.Time
-	Priority       int
-	AssignedWasher string
-	Status         string
+	ID              int
+	LoadType        int
+	Program         string  // Programa que pidió el cliente; vacío usa el del tipo de carga
+	ResolvedProgram string  // Programa con el que la lavadora atiende el trabajo actual
+	WeightKg        float64 // Peso de la carga; cero ocupa una lavadora completa
+	Fabric          string  // Categoría de tela (ver Fabrics)
+	AllowMixing     bool    // El cliente acepta compartir el ciclo con otras órdenes
+	SharedCycle     []int   // Órdenes lavadas en el mismo ciclo, incluida esta
+	StartTime       time.Time
+	EndTime         time.Time
+	Priority        int
+	AssignedWasher  string
+	JobID           string
+	WashStage       string // Etapa del programa que informa la lavadora
+	Status          OrderState
+	Attempts        int
+	LastFailure     FailureKind
+	LastError       string
+	NextAttemptAt   *time.Time
+	Stages          []OrderStage // Paso por la lavadora y la secadora
+	History         []StateTransition
 }
 
 type LaundryServer struct {
@@ -27,120 +43,517 @@ type LaundryServer struct {
 	orderMutex sync.Mutex
 	orderID    int
 	washerURL  string
-	waitQueue  chan *LaundryOrder
+	dryerURL   string
+	queue      *OrderScheduler
+	pool       *DispatchPool
+	store      OrderStore
+	events     *EventBroker
+	retry      RetryPolicy
+
+	serviceTime *serviceTimeEstimator
 }
 
-const (
-	WasherServerURL = "http://localhost:4007/start"
-	MaxQueueSize    = 100
-)
+const WasherServerURL = "http://localhost:4007"
 
-func NewLaundryServer() *LaundryServer {
-	return &LaundryServer{
+func NewLaundryServer(store OrderStore) *LaundryServer {
+	ls := &LaundryServer{
 		orders:    []*LaundryOrder{},
 		washerURL: WasherServerURL,
-		waitQueue: make(chan *LaundryOrder, MaxQueueSize),
+		dryerURL:  DryerServerURL,
+		queue:     NewOrderScheduler(LoadQueueLimit(), AgingInterval),
+		store:     store,
+		events:    NewEventBroker(),
+		retry:     LoadRetryPolicy(),
+
+		serviceTime: newServiceTimeEstimator(),
+	}
+	ls.pool = NewDispatchPool(ls)
+	return ls
+}
+
+// Restore carga las órdenes guardadas antes de aceptar peticiones, para que los
+// IDs nuevos continúen la numeración, y reanuda en segundo plano las que quedaron
+// sin terminar.
+func (ls *LaundryServer) Restore() error {
+	saved, err := ls.store.Load()
+	if err != nil {
+		return err
+	}
+
+	ls.orderMutex.Lock()
+	var pending, running, interrupted []*LaundryOrder
+	for i := range saved {
+		order := &saved[i]
+		order.Status = normalizeState(order.Status)
+		ls.orders = append(ls.orders, order)
+		if order.ID > ls.orderID {
+			ls.orderID = order.ID
+		}
+
+		switch order.Status {
+		case StatePending:
+			pending = append(pending, order)
+		case StateDispatched, StateWashing:
+			if order.JobID != "" {
+				running = append(running, order)
+			} else {
+				interrupted = append(interrupted, order)
+			}
+		case StateDrying:
+			if order.stage(StageDry).JobID != "" {
+				running = append(running, order)
+			} else {
+				interrupted = append(interrupted, order)
+			}
+		case StateRetrying:
+			interrupted = append(interrupted, order)
+		}
+	}
+	ls.orderMutex.Unlock()
+
+	fmt.Printf("Se restauraron %d órdenes: %d pendientes, %d en proceso y %d por reintentar\n",
+		len(saved), len(pending), len(running), len(interrupted))
+
+	go ls.resume(pending, running, interrupted)
+	return nil
+}
+
+// resume vuelve a encolar las órdenes pendientes o interrumpidas y retoma el
+// seguimiento de las que estaban en una lavadora o una secadora cuando el
+// servicio se detuvo
+func (ls *LaundryServer) resume(pending, running, interrupted []*LaundryOrder) {
+	for _, order := range running {
+		current := ls.snapshot(order)
+		if current.Status == StateDrying {
+			go ls.watchDryJob(order, current.stage(StageDry).JobID)
+			continue
+		}
+		go ls.watchJob(order, current.JobID)
+	}
+	for _, order := range interrupted {
+		if ls.snapshot(order).Status == StateRetrying {
+			ls.releaseRetry(order)
+			continue
+		}
+		ls.handleFailure(order, FailureJobLost, "El servicio se reinició durante el despacho")
+	}
+	for _, order := range pending {
+		ls.enqueue(order)
+	}
+}
+
+// OrderSpec son los datos con los que se crea una orden
+type OrderSpec struct {
+	LoadType    int
+	Program     string
+	Priority    int
+	WeightKg    float64
+	Fabric      string
+	AllowMixing bool
+}
+
+// OrderChanges son los cambios a una orden pendiente; los campos nil no cambian
+type OrderChanges struct {
+	LoadType    *int
+	Program     *string
+	Priority    *int
+	WeightKg    *float64
+	Fabric      *string
+	AllowMixing *bool
+}
+
+// checkCapacity devuelve un *CapacityError si la carga no cabe en ninguna lavadora
+// que admita el programa. Mientras no se conozca la flota no rechaza nada.
+func (ls *LaundryServer) checkCapacity(program string, loadType int, weightKg float64) error {
+	if maxKg := ls.pool.MaxLoadKg(program, loadType); maxKg > 0 && weightKg > maxKg {
+		return &CapacityError{WeightKg: weightKg, MaxKg: maxKg}
 	}
+	return nil
 }
 
-func (ls *LaundryServer) AddOrder(loadType int, priority int) *LaundryOrder {
+// AddOrder registra una orden nueva y la encola. Si la cola está llena devuelve
+// errQueueFull sin consumir un ID, para que el cliente reintente más tarde.
+func (ls *LaundryServer) AddOrder(spec OrderSpec) (LaundryOrder, error) {
+	if err := ls.checkCapacity(spec.Program, spec.LoadType, spec.WeightKg); err != nil {
+		return LaundryOrder{}, err
+	}
+
 	ls.orderMutex.Lock()
 	defer ls.orderMutex.Unlock()
 
+	if ls.queue.Full() {
+		return LaundryOrder{}, errQueueFull
+	}
+
 	ls.orderID++
+	now := clock.Now()
 	order := &LaundryOrder{
-		ID:       ls.orderID,
-		LoadType: loadType,
-		Priority: priority,
-		Status:   "Pendiente",
+		ID:          ls.orderID,
+		LoadType:    spec.LoadType,
+		Program:     spec.Program,
+		Priority:    spec.Priority,
+		WeightKg:    spec.WeightKg,
+		Fabric:      spec.Fabric,
+		AllowMixing: spec.AllowMixing,
+		Status:      StatePending,
+		History:     []StateTransition{{To: StatePending, At: now, Reason: "Orden creada"}},
+	}
+	if err := ls.store.Save(*order); err != nil {
+		return LaundryOrder{}, fmt.Errorf("no se pudo guardar la orden ID %d: %v", order.ID, err)
 	}
 	ls.orders = append(ls.orders, order)
+	ls.publish(*order, order.History[0])
 
-	// Agregar a la cola de espera para ser procesada
-	ls.waitQueue <- order
-	return order
+	// Agregar a la cola de espera para ser procesada según su prioridad
+	ls.queue.Push(order, spec.Priority, spec.LoadType)
+	return *order, nil
 }
 
-func (ls *LaundryServer) processOrders() {
-	for order := range ls.waitQueue {
-		ls.assignOrderToWasher(order)
+// updateOrder aplica un cambio que no altera el estado de la orden y lo persiste
+func (ls *LaundryServer) updateOrder(order *LaundryOrder, change func(o *LaundryOrder)) {
+	ls.orderMutex.Lock()
+	defer ls.orderMutex.Unlock()
+
+	change(order)
+	if err := ls.store.Save(*order); err != nil {
+		fmt.Printf("No se pudo guardar la orden ID %d: %v\n", order.ID, err)
 	}
 }
 
+// transition mueve la orden al siguiente estado si la tabla lo permite, aplica los
+// cambios adicionales, persiste el resultado y notifica a los clientes SSE
+func (ls *LaundryServer) transition(order *LaundryOrder, next OrderState, reason string, change func(o *LaundryOrder)) error {
+	ls.orderMutex.Lock()
+	defer ls.orderMutex.Unlock()
+
+	if err := order.transitionTo(next, reason, clock.Now()); err != nil {
+		fmt.Printf("Transición rechazada: %v\n", err)
+		return err
+	}
+	if change != nil {
+		change(order)
+	}
+	if err := ls.store.Save(*order); err != nil {
+		fmt.Printf("No se pudo guardar la orden ID %d: %v\n", order.ID, err)
+	}
+	ls.publish(*order, order.History[len(order.History)-1])
+	return nil
+}
+
+// publish emite la transición de una orden; se llama con orderMutex tomado para
+// que los eventos salgan en el mismo orden en que ocurrieron
+func (ls *LaundryServer) publish(order LaundryOrder, change StateTransition) {
+	ls.events.Publish(OrderEvent{
+		OrderID:        order.ID,
+		PreviousStatus: change.From,
+		Status:         change.To,
+		Reason:         change.Reason,
+		Timestamp:      change.At,
+		Order:          newOrderResponse(order),
+	})
+}
+
+// snapshot devuelve una copia de la orden tomada bajo el candado
+func (ls *LaundryServer) snapshot(order *LaundryOrder) LaundryOrder {
+	ls.orderMutex.Lock()
+	defer ls.orderMutex.Unlock()
+	return *order
+}
+
+// enqueue agrega a la cola una orden que ya existe usando su prioridad actual
+func (ls *LaundryServer) enqueue(order *LaundryOrder) {
+	current := ls.snapshot(order)
+	ls.queue.Push(order, current.Priority, current.LoadType)
+}
+
 func (ls *LaundryServer) assignOrderToWasher(order *LaundryOrder) {
-	query := fmt.Sprintf("%s?load=%d", ls.washerURL, order.LoadType)
-	resp, err := http.Get(query)
-	if err != nil {
-		fmt.Printf("Error al enviar la orden ID %d al servidor de lavadoras: %v\n", order.ID, err)
-		order.Status = "Error"
+	// Una orden que vuelve a la cola después de lavarse solo necesita la secadora
+	if ls.snapshot(order).washed() {
+		ls.sendToDryer(order, "Enviada al servicio de secadoras", nil)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		order.StartTime = time.Now()
-		order.Status = "En Proceso"
+	if err := ls.transition(order, StateDispatched, "Enviada al servicio de lavadoras", nil); err != nil {
+		return
+	}
 
-		done := make(chan string)
-		go func() {
-			defer close(done)
+	// Si el cliente lo permite, otras órdenes compatibles de la cola comparten el ciclo
+	cycle, weightKg := ls.dispatchCycle(order, ls.packCycle(order))
 
-			var response map[string]interface{}
-			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-				done <- fmt.Sprintf("Error al completar la orden ID %d: %v", order.ID, err)
-				return
-			}
+	current := ls.snapshot(order)
+	job, status, err := submitWashJob(ls.washerURL, current.LoadType, current.Program, weightKg)
+	if err != nil {
+		fmt.Printf("No se pudo asignar la orden ID %d: %v\n", order.ID, err)
+		kind := classifySubmitFailure(status)
+		var overweight *CapacityError
+		if errors.As(err, &overweight) && len(cycle) > 1 {
+			// El ciclo compartido no cupo: cada orden vuelve a la cola por su cuenta y
+			// el siguiente armado usa la capacidad que informó la lavadora
+			ls.pool.limitLoad(current.Program, current.LoadType, overweight.MaxKg)
+			kind = FailureOverweight
+		}
+		for _, member := range cycle {
+			ls.handleFailure(member, kind, err.Error())
+		}
+		return
+	}
 
-			message, ok := response["message"].(string)
-			if !ok {
-				done <- fmt.Sprintf("Respuesta inesperada del servidor de lavadoras para la orden ID %d", order.ID)
-				return
-			}
+	active := ls.startCycle(cycle, job)
+	if len(active) == 0 {
+		// Todas las órdenes se cancelaron mientras se creaba el trabajo
+		if err := abortJob(ls.washerURL, job.ID); err != nil && !errors.Is(err, errJobFinished) {
+			fmt.Printf("No se pudo abortar el trabajo %s de la orden cancelada ID %d: %v\n", job.ID, order.ID, err)
+		}
+		return
+	}
 
-			done <- message
-		}()
+	for _, member := range active[1:] {
+		go ls.watchJob(member, job.ID)
+	}
+	ls.watchJob(active[0], job.ID)
+}
 
-		// Esperar la confirmación de finalización
-		message := <-done
-		order.EndTime = time.Now()
-		order.Status = "Completado"
-		order.AssignedWasher = "Lavadora asignada"
-		fmt.Printf("Orden ID %d finalizada con éxito. Mensaje: %s\n", order.ID, message)
-	} else {
-		fmt.Printf("No se pudo asignar la orden ID %d, reintentando más tarde.\n", order.ID)
-		order.Status = "Pendiente"
-		ls.waitQueue <- order // Reagregar a la cola si falla
+// watchJob consulta el trabajo de lavado hasta su finalización y cierra la orden
+func (ls *LaundryServer) watchJob(order *LaundryOrder, jobID string) {
+	result, err := waitForWashJob(ls.washerURL, jobID, func(job *washJob) {
+		if job.Phase == "washing" && ls.snapshot(order).Status == StateDispatched {
+			ls.transition(order, StateWashing, fmt.Sprintf("Lavando en %s con el programa %s", job.Washer, job.Program), func(o *LaundryOrder) {
+				o.AssignedWasher = job.Washer
+				o.WashStage = job.Stage
+			})
+			return
+		}
+		ls.updateOrder(order, func(o *LaundryOrder) {
+			o.AssignedWasher = job.Washer
+			o.WashStage = job.Stage
+		})
+	})
+	if (err != nil || result.Phase == "failed") && !ls.claimJob(order, jobID) {
+		// El aviso de falla de la lavadora ya volvió a despachar la orden
+		return
+	}
+	if errors.Is(err, errJobNotFound) {
+		// El servicio de lavadoras se reinició y perdió el trabajo
+		fmt.Printf("El trabajo %s de la orden ID %d ya no existe.\n", jobID, order.ID)
+		ls.handleFailure(order, FailureJobLost, fmt.Sprintf("El trabajo %s ya no existe", jobID))
+		return
+	}
+	if err != nil {
+		// Se perdió contacto con el servicio; abortar por si el trabajo sigue corriendo
+		fmt.Printf("Error al completar la orden ID %d: %v\n", order.ID, err)
+		if abortErr := abortJob(ls.washerURL, jobID); abortErr != nil && !errors.Is(abortErr, errJobFinished) {
+			fmt.Printf("No se pudo abortar el trabajo %s: %v\n", jobID, abortErr)
+		}
+		ls.handleFailure(order, FailureUnavailable, err.Error())
+		return
+	}
+
+	if result.Phase == "aborted" {
+		if ls.snapshot(order).Status != StateCancelled {
+			ls.transition(order, StateCancelled, "El servicio de lavadoras abortó el trabajo", nil)
+		}
+		return
 	}
+
+	if result.Phase == "failed" {
+		fmt.Printf("La lavadora no pudo completar la orden ID %d: %s\n", order.ID, result.Error)
+		kind := FailureWashFailed
+		if result.Fault != "" {
+			kind = FailureWasherFault
+		}
+		ls.handleFailure(order, kind, result.Error)
+		return
+	}
+
+	fmt.Printf("Orden ID %d lavada. Mensaje: %s\n", order.ID, result.Message)
+	ls.sendToDryer(order, result.Message, func(o *LaundryOrder) {
+		now := clock.Now()
+		o.WashStage = ""
+		o.AssignedWasher = result.Washer
+		o.finishStage(StageWash, result.Washer, now)
+		ls.serviceTime.Observe(now.Sub(o.StartTime))
+	})
 }
 
-func (ls *LaundryServer) GetOrders() []*LaundryOrder {
+// GetOrders devuelve una copia de todas las órdenes
+func (ls *LaundryServer) GetOrders() []LaundryOrder {
 	ls.orderMutex.Lock()
 	defer ls.orderMutex.Unlock()
-	return ls.orders
+
+	orders := make([]LaundryOrder, len(ls.orders))
+	for i, order := range ls.orders {
+		orders[i] = *order
+	}
+	return orders
 }
 
-func (ls *LaundryServer) GetOrderByID(id int) (*LaundryOrder, bool) {
+func (ls *LaundryServer) GetOrderByID(id int) (LaundryOrder, bool) {
 	ls.orderMutex.Lock()
 	defer ls.orderMutex.Unlock()
 
+	if order := ls.findOrder(id); order != nil {
+		return *order, true
+	}
+	return LaundryOrder{}, false
+}
+
+var (
+	errOrderNotFound   = errors.New("orden no encontrada")
+	errOrderNotPending = errors.New("solo se pueden modificar órdenes pendientes")
+)
+
+// findOrder busca una orden por ID; requiere orderMutex tomado
+func (ls *LaundryServer) findOrder(id int) *LaundryOrder {
 	for _, order := range ls.orders {
 		if order.ID == id {
-			return order, true
+			return order
 		}
 	}
-	return nil, false
+	return nil
+}
+
+// CancelOrder cancela una orden. Si ya está en una lavadora o en una secadora se
+// pide abortar el trabajo y la orden solo se cancela si el servicio confirma el
+// aborto. Si el trabajo ya había terminado la orden no se toca y se devuelve
+// errJobFinished: su resultado lo recoge quien vigila el trabajo.
+func (ls *LaundryServer) CancelOrder(id int) (LaundryOrder, error) {
+	ls.orderMutex.Lock()
+	order := ls.findOrder(id)
+	if order == nil {
+		ls.orderMutex.Unlock()
+		return LaundryOrder{}, errOrderNotFound
+	}
+	current := *order
+	ls.orderMutex.Unlock()
+
+	if !current.Status.CanTransition(StateCancelled) {
+		return current, &InvalidTransitionError{OrderID: id, From: current.Status, To: StateCancelled}
+	}
+
+	// Si la orden comparte el ciclo con otras, el lavado sigue para las demás
+	if current.JobID != "" && (current.Status == StateDispatched || current.Status == StateWashing) && !ls.sharesActiveCycle(current) {
+		if err := abortJob(ls.washerURL, current.JobID); err != nil {
+			return current, fmt.Errorf("no se pudo abortar el trabajo %s: %w", current.JobID, err)
+		}
+	}
+	if dryJobID := current.stage(StageDry).JobID; current.Status == StateDrying && dryJobID != "" {
+		if err := abortJob(ls.dryerURL, dryJobID); err != nil {
+			return current, fmt.Errorf("no se pudo abortar el trabajo %s: %w", dryJobID, err)
+		}
+	}
+
+	err := ls.transition(order, StateCancelled, "Cancelada por el cliente", nil)
+	final := ls.snapshot(order)
+	if err != nil && final.Status != StateCancelled {
+		return final, err
+	}
+	ls.queue.Remove(id)
+	return final, nil
+}
+
+// ModifyOrder cambia los datos de una orden que aún no se ha despachado
+func (ls *LaundryServer) ModifyOrder(id int, changes OrderChanges) (LaundryOrder, error) {
+	ls.orderMutex.Lock()
+	order := ls.findOrder(id)
+	if order == nil {
+		ls.orderMutex.Unlock()
+		return LaundryOrder{}, errOrderNotFound
+	}
+	if order.Status != StatePending && order.Status != StateRetrying {
+		current := *order
+		ls.orderMutex.Unlock()
+		return current, errOrderNotPending
+	}
+
+	loadType, program, weightKg := order.LoadType, order.Program, order.WeightKg
+	fabric, allowMixing := order.Fabric, order.AllowMixing
+	if changes.LoadType != nil {
+		loadType = *changes.LoadType
+	}
+	if changes.Program != nil {
+		program = *changes.Program
+	}
+	if changes.WeightKg != nil {
+		weightKg = *changes.WeightKg
+	}
+	if changes.Fabric != nil {
+		fabric = *changes.Fabric
+	}
+	if changes.AllowMixing != nil {
+		allowMixing = *changes.AllowMixing
+	}
+	// Validar la orden resultante, no solo los campos que cambian
+	if missing := mixingErrors(allowMixing, weightKg, fabric); missing != nil {
+		current := *order
+		ls.orderMutex.Unlock()
+		return current, &MixingError{Missing: missing}
+	}
+	if err := ls.checkCapacity(program, loadType, weightKg); err != nil {
+		current := *order
+		ls.orderMutex.Unlock()
+		return current, err
+	}
+
+	if changes.LoadType != nil {
+		order.LoadType = *changes.LoadType
+	}
+	if changes.Program != nil {
+		order.Program = *changes.Program
+	}
+	if changes.Priority != nil {
+		order.Priority = *changes.Priority
+	}
+	if changes.WeightKg != nil {
+		order.WeightKg = *changes.WeightKg
+	}
+	if changes.Fabric != nil {
+		order.Fabric = *changes.Fabric
+	}
+	if changes.AllowMixing != nil {
+		order.AllowMixing = *changes.AllowMixing
+	}
+	if err := ls.store.Save(*order); err != nil {
+		fmt.Printf("No se pudo guardar la orden ID %d: %v\n", order.ID, err)
+	}
+	current := *order
+	ls.orderMutex.Unlock()
+
+	// Reubicar la orden en la cola; si un despachador ya la tomó, leerá los valores nuevos
+	ls.queue.Update(id, current.Priority, current.LoadType)
+	return current, nil
 }
 
 func main() {
-	laundryServer := NewLaundryServer()
+	if err := clock.Setup(); err != nil {
+		log.Fatalf("Configuración del reloj inválida: %v", err)
+	}
 
-	// Iniciar procesamiento de órdenes en la cola
-	go laundryServer.processOrders()
+	store, err := OpenOrderStore()
+	if err != nil {
+		log.Fatalf("No se pudo abrir el almacén de órdenes: %v", err)
+	}
+	defer store.Close()
+
+	laundryServer := NewLaundryServer(store)
+
+	// Reanudar las órdenes que quedaron pendientes antes del reinicio
+	if err := laundryServer.Restore(); err != nil {
+		log.Fatalf("No se pudieron restaurar las órdenes: %v", err)
+	}
+
+	// Iniciar los despachadores que procesan la cola en paralelo
+	go laundryServer.pool.Run()
 
 	r := gin.Default()
+	clock.RegisterRoutes(r)
+
+	registerV1Routes(r, laundryServer)
+
+	// Rutas anteriores a /v1: se conservan por compatibilidad y responden con la
+	// cabecera Deprecation apuntando a su reemplazo
 
 	// Endpoint para crear una nueva orden
-	r.POST("/order", func(c *gin.Context) {
+	r.POST("/order", deprecated("/v1/orders"), func(c *gin.Context) {
 		loadTypeStr := c.Query("loadType")
 		priorityStr := c.Query("priority")
 		if loadTypeStr == "" || priorityStr == "" {
@@ -150,36 +563,50 @@ func main() {
 
 		loadType, err1 := strconv.Atoi(loadTypeStr)
 		priority, err2 := strconv.Atoi(priorityStr)
-		if err1 != nil || err2 != nil || loadType < 1 || loadType > 3 || priority < 0 {
+		if err1 != nil || err2 != nil || loadType < 1 || loadType > 3 || priority < 0 || priority > MaxPriority {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Parámetros inválidos"})
 			return
 		}
+		program := c.Query("program")
+		if program != "" && !validProgram(program) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Programa desconocido", "programs": WashPrograms})
+			return
+		}
 
-		order := laundryServer.AddOrder(loadType, priority)
-
-		// Esperar a que la orden sea procesada
-		message := make(chan string)
-		go func() {
-			<-message // Bloquear hasta que la orden termine
-		}()
+		order, err := laundryServer.AddOrder(OrderSpec{LoadType: loadType, Program: program, Priority: priority})
+		if errors.Is(err, errQueueFull) {
+			retryAfter := laundryServer.RetryAfter()
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":               "La cola de órdenes está llena, intente más tarde",
+				"retry_after_seconds": retryAfter,
+				"queue":               laundryServer.QueueStatus(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": fmt.Sprintf("Orden ID %d en cola", order.ID),
 			"details": gin.H{
-				"order_id": order.ID,
-				"status":   order.Status,
+				"order_id":    order.ID,
+				"status":      order.Status,
+				"queue_depth": laundryServer.queue.Len(),
 			},
 		})
 	})
 
 	// Endpoint para listar todas las órdenes
-	r.GET("/orders", func(c *gin.Context) {
+	r.GET("/orders", deprecated("/v1/orders"), func(c *gin.Context) {
 		orders := laundryServer.GetOrders()
 		c.JSON(http.StatusOK, orders)
 	})
 
 	// Endpoint para obtener una orden específica
-	r.GET("/order/:id", func(c *gin.Context) {
+	r.GET("/order/:id", deprecated("/v1/orders/{id}"), func(c *gin.Context) {
 		idStr := c.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
@@ -196,5 +623,119 @@ func main() {
 		c.JSON(http.StatusOK, order)
 	})
 
+	// Lista de órdenes que agotaron sus reintentos
+	r.GET("/orders/failed", deprecated("/v1/orders/failed"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, laundryServer.FailedOrders())
+	})
+
+	// Endpoint para reintentar manualmente una orden fallida
+	r.POST("/order/:id/retry", deprecated("/v1/orders/{id}/retry"), func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+			return
+		}
+
+		order, err := laundryServer.RetryOrder(id)
+		var invalid *InvalidTransitionError
+		switch {
+		case errors.Is(err, errOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Orden no encontrada"})
+		case errors.As(err, &invalid):
+			c.JSON(http.StatusConflict, gin.H{"error": "Solo se pueden reintentar órdenes fallidas", "order": order})
+		default:
+			c.JSON(http.StatusAccepted, order)
+		}
+	})
+
+	// Endpoint para cancelar una orden
+	r.DELETE("/order/:id", deprecated("/v1/orders/{id}"), func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+			return
+		}
+
+		order, err := laundryServer.CancelOrder(id)
+		var invalid *InvalidTransitionError
+		switch {
+		case errors.Is(err, errOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Orden no encontrada"})
+		case errors.As(err, &invalid), errors.Is(err, errJobFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "order": order})
+		case err != nil:
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "order": order})
+		default:
+			c.JSON(http.StatusOK, order)
+		}
+	})
+
+	// Endpoint para cambiar el tipo de carga, el programa o la prioridad de una orden pendiente
+	r.PATCH("/order/:id", deprecated("/v1/orders/{id}"), func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+			return
+		}
+
+		var loadType, priority *int
+		var program *string
+		if value, ok := c.GetQuery("program"); ok {
+			if !validProgram(value) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Programa desconocido", "programs": WashPrograms})
+				return
+			}
+			program = &value
+		}
+		if value, ok := c.GetQuery("loadType"); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 3 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'loadType' debe ser 1, 2 o 3"})
+				return
+			}
+			loadType = &parsed
+		}
+		if value, ok := c.GetQuery("priority"); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 || parsed > MaxPriority {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("El parámetro 'priority' debe ser un entero entre 0 y %d", MaxPriority)})
+				return
+			}
+			priority = &parsed
+		}
+		if loadType == nil && program == nil && priority == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Se requiere 'loadType', 'program' o 'priority'"})
+			return
+		}
+
+		order, err := laundryServer.ModifyOrder(id, OrderChanges{LoadType: loadType, Program: program, Priority: priority})
+		switch {
+		case errors.Is(err, errOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Orden no encontrada"})
+		case errors.Is(err, errOrderNotPending):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "order": order})
+		case err != nil:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "order": order})
+		default:
+			c.JSON(http.StatusOK, order)
+		}
+	})
+
+	// Flujos SSE con cada cambio de estado de una orden o de todas
+	r.GET("/order/:id/events", deprecated("/v1/orders/{id}/events"), orderEventsHandler(laundryServer))
+	r.GET("/orders/events", deprecated("/v1/orders/events"), allOrderEventsHandler(laundryServer))
+
+	// Endpoint para consultar el orden de despacho de la cola
+	r.GET("/queue", deprecated("/v1/queue"), func(c *gin.Context) {
+		status := laundryServer.QueueStatus()
+		c.JSON(http.StatusOK, gin.H{
+			"length":         status.Depth,
+			"aging_interval": AgingInterval.String(),
+			"workers":        status.Workers,
+			"status":         status,
+			"orders":         laundryServer.queue.Snapshot(),
+		})
+	})
+
 	r.Run(":4010")
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+// Fabrics son las categorías de tela que acepta una orden. Solo comparten ciclo
+// órdenes de la misma categoría.
+var Fabrics = []string{"cotton", "synthetic", "delicate", "wool", "denim"}
+
+// packable indica si la orden puede compartir el ciclo con órdenes de otros
+// clientes: el cliente lo permitió y se conoce su peso y su tela
+func (o LaundryOrder) packable() bool {
+	return o.AllowMixing && o.WeightKg > 0 && o.Fabric != ""
+}
+
+// compatibleWith indica si other puede lavarse en el mismo ciclo que la orden
+func (o LaundryOrder) compatibleWith(other LaundryOrder) bool {
+	return other.packable() &&
+		other.Status == StatePending &&
+		!other.washed() &&
+		other.Fabric == o.Fabric &&
+		other.LoadType == o.LoadType &&
+		other.Program == o.Program
+}
+
+// packCycle saca de la cola las órdenes compatibles con primary que caben junto
+// con ella en la lavadora más grande que admite su programa. Recorre la cola en
+// orden de despacho y toma cada orden que quepa, así que las de mayor prioridad se
+// acomodan primero.
+func (ls *LaundryServer) packCycle(primary *LaundryOrder) []*LaundryOrder {
+	current := ls.snapshot(primary)
+	capacity := ls.pool.MaxLoadKg(current.Program, current.LoadType)
+	if !current.packable() || capacity <= 0 {
+		return nil
+	}
+
+	load := current.WeightKg
+	var companions []*LaundryOrder
+	for _, entry := range ls.queue.Snapshot() {
+		ls.orderMutex.Lock()
+		candidate := ls.findOrder(entry.OrderID)
+		var snapshot LaundryOrder
+		if candidate != nil {
+			snapshot = *candidate
+		}
+		ls.orderMutex.Unlock()
+
+		if candidate == nil || !current.compatibleWith(snapshot) || load+snapshot.WeightKg > capacity {
+			continue
+		}
+		// Otro despachador pudo tomarla entre la foto de la cola y este punto
+		if !ls.queue.Remove(entry.OrderID) {
+			continue
+		}
+		companions = append(companions, candidate)
+		load += snapshot.WeightKg
+	}
+	return companions
+}
+
+// dispatchCycle pasa a despachadas las órdenes que acompañan a primary y devuelve
+// las que quedaron en el ciclo, primary primero, con el peso total
+func (ls *LaundryServer) dispatchCycle(primary *LaundryOrder, companions []*LaundryOrder) ([]*LaundryOrder, float64) {
+	cycle := []*LaundryOrder{primary}
+	weightKg := ls.snapshot(primary).WeightKg
+	for _, companion := range companions {
+		// Si el cliente la canceló mientras se armaba el ciclo, la transición falla
+		reason := fmt.Sprintf("Comparte el ciclo de la orden ID %d", primary.ID)
+		if err := ls.transition(companion, StateDispatched, reason, nil); err != nil {
+			continue
+		}
+		cycle = append(cycle, companion)
+		weightKg += ls.snapshot(companion).WeightKg
+	}
+	if len(cycle) > 1 {
+		fmt.Printf("Orden ID %d comparte el ciclo con %d órdenes (%.1f kg)\n", primary.ID, len(cycle)-1, weightKg)
+	}
+	return cycle, weightKg
+}
+
+// startCycle registra el trabajo de lavado en cada orden del ciclo. Devuelve las
+// que siguen activas; las que se cancelaron mientras se creaba el trabajo quedan fuera.
+func (ls *LaundryServer) startCycle(cycle []*LaundryOrder, job *washJob) []*LaundryOrder {
+	ids := make([]int, len(cycle))
+	for i, order := range cycle {
+		ids[i] = order.ID
+	}
+
+	now := clock.Now()
+	var active []*LaundryOrder
+	for _, order := range cycle {
+		cancelled := false
+		ls.updateOrder(order, func(o *LaundryOrder) {
+			if o.Status == StateCancelled {
+				cancelled = true
+				return
+			}
+			o.StartTime = now
+			o.AssignedWasher = job.Washer
+			o.JobID = job.ID
+			o.startStage(StageWash, job.Washer, job.ID, o.StartTime)
+			o.ResolvedProgram = job.Program
+			o.WashStage = ""
+			o.SharedCycle = nil
+			if len(ids) > 1 {
+				o.SharedCycle = ids
+			}
+		})
+		if !cancelled {
+			active = append(active, order)
+		}
+	}
+	return active
+}
+
+// sharesActiveCycle indica si otra orden sigue lavándose con el mismo trabajo;
+// en ese caso cancelar la orden no debe abortar el ciclo
+func (ls *LaundryServer) sharesActiveCycle(order LaundryOrder) bool {
+	ls.orderMutex.Lock()
+	defer ls.orderMutex.Unlock()
+
+	for _, other := range ls.orders {
+		if other.ID != order.ID && other.JobID == order.JobID &&
+			(other.Status == StateDispatched || other.Status == StateWashing) {
+			return true
+		}
+	}
+	return false
+}
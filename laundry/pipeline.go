@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+// Etapas del recorrido de una orden: primero la lavadora, luego la secadora
+const (
+	StageWash = "wash"
+	StageDry  = "dry"
+)
+
+// OrderStage registra el paso de una orden por una máquina
+type OrderStage struct {
+	Name       string     `json:"name"`
+	Machine    string     `json:"machine,omitempty"`
+	JobID      string     `json:"job_id,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// stage devuelve el registro de la etapa indicada o uno vacío si aún no empezó
+func (o LaundryOrder) stage(name string) OrderStage {
+	for _, stage := range o.Stages {
+		if stage.Name == name {
+			return stage
+		}
+	}
+	return OrderStage{Name: name}
+}
+
+// washed indica si la orden ya pasó por la lavadora y solo le falta secarse
+func (o LaundryOrder) washed() bool {
+	return o.stage(StageWash).FinishedAt != nil
+}
+
+// updateStage modifica el registro de una etapa sobre una copia de la lista, para
+// que las copias de la orden que ya se entregaron no cambien por debajo
+func (o *LaundryOrder) updateStage(name string, change func(stage *OrderStage)) {
+	stages := make([]OrderStage, 0, len(o.Stages)+1)
+	found := false
+	for _, stage := range o.Stages {
+		if stage.Name == name {
+			change(&stage)
+			found = true
+		}
+		stages = append(stages, stage)
+	}
+	if !found {
+		stage := OrderStage{Name: name}
+		change(&stage)
+		stages = append(stages, stage)
+	}
+	o.Stages = stages
+}
+
+// startStage marca el comienzo de una etapa en la máquina indicada. Si la etapa
+// se repite por un reintento, se sobrescribe el intento anterior.
+func (o *LaundryOrder) startStage(name, machine, jobID string, at time.Time) {
+	o.updateStage(name, func(stage *OrderStage) {
+		stage.Machine = machine
+		stage.JobID = jobID
+		stage.StartedAt = &at
+		stage.FinishedAt = nil
+	})
+}
+
+// finishStage marca el fin de una etapa y la máquina que la completó
+func (o *LaundryOrder) finishStage(name, machine string, at time.Time) {
+	o.updateStage(name, func(stage *OrderStage) {
+		stage.Machine = machine
+		stage.FinishedAt = &at
+	})
+}
+
+// sendToDryer lleva a la secadora una orden que ya se lavó. El despachador no
+// espera el secado, así que queda libre para la siguiente orden de la cola.
+func (ls *LaundryServer) sendToDryer(order *LaundryOrder, reason string, change func(o *LaundryOrder)) {
+	err := ls.transition(order, StateDrying, reason, func(o *LaundryOrder) {
+		if change != nil {
+			change(o)
+		}
+		// Descartar el trabajo de un intento anterior para no seguirlo tras un reinicio
+		o.updateStage(StageDry, func(stage *OrderStage) { stage.JobID = "" })
+	})
+	if err != nil {
+		return
+	}
+	go ls.dryOrder(order)
+}
+
+// dryOrder crea el trabajo de secado y lo sigue hasta terminar la orden
+func (ls *LaundryServer) dryOrder(order *LaundryOrder) {
+	current := ls.snapshot(order)
+	job, status, err := submitDryJob(ls.dryerURL, current.LoadType, current.WeightKg)
+	if err != nil {
+		fmt.Printf("No se pudo enviar la orden ID %d a una secadora: %v\n", order.ID, err)
+		ls.handleFailure(order, classifySubmitFailure(status), fmt.Sprintf("secadora: %v", err))
+		return
+	}
+
+	cancelled := false
+	ls.updateOrder(order, func(o *LaundryOrder) {
+		if o.Status == StateCancelled {
+			cancelled = true
+			return
+		}
+		o.startStage(StageDry, job.Dryer, job.ID, clock.Now())
+	})
+	if cancelled {
+		if err := abortJob(ls.dryerURL, job.ID); err != nil && !errors.Is(err, errJobFinished) {
+			fmt.Printf("No se pudo abortar el trabajo %s de la orden cancelada ID %d: %v\n", job.ID, order.ID, err)
+		}
+		return
+	}
+
+	ls.watchDryJob(order, job.ID)
+}
+
+// watchDryJob consulta el trabajo de secado y cierra la orden
+func (ls *LaundryServer) watchDryJob(order *LaundryOrder, jobID string) {
+	result, err := waitForDryJob(ls.dryerURL, jobID)
+	if errors.Is(err, errJobNotFound) {
+		fmt.Printf("El trabajo de secado %s de la orden ID %d ya no existe.\n", jobID, order.ID)
+		ls.handleFailure(order, FailureJobLost, fmt.Sprintf("El trabajo %s ya no existe", jobID))
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error al secar la orden ID %d: %v\n", order.ID, err)
+		if abortErr := abortJob(ls.dryerURL, jobID); abortErr != nil && !errors.Is(abortErr, errJobFinished) {
+			fmt.Printf("No se pudo abortar el trabajo %s: %v\n", jobID, abortErr)
+		}
+		ls.handleFailure(order, FailureUnavailable, err.Error())
+		return
+	}
+
+	switch result.Phase {
+	case "aborted":
+		if ls.snapshot(order).Status != StateCancelled {
+			ls.transition(order, StateCancelled, "El servicio de secadoras abortó el trabajo", nil)
+		}
+		return
+	case "failed":
+		fmt.Printf("La secadora no pudo completar la orden ID %d: %s\n", order.ID, result.Error)
+		ls.handleFailure(order, FailureDryFailed, result.Error)
+		return
+	}
+
+	err = ls.transition(order, StateCompleted, result.Message, func(o *LaundryOrder) {
+		o.EndTime = clock.Now()
+		o.finishStage(StageDry, result.Dryer, o.EndTime)
+	})
+	if err == nil {
+		fmt.Printf("Orden ID %d lavada y secada. Mensaje: %s\n", order.ID, result.Message)
+	}
+}
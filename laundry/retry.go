@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+// Pausa antes de reencolar una orden rechazada porque no había lavadoras libres
+const BusyWashersDelay = 1 * time.Second
+
+// Variables de entorno que ajustan la política de reintentos
+const (
+	RetryMaxAttemptsEnv = "LAUNDRY_RETRY_MAX_ATTEMPTS"
+	RetryBaseDelayEnv   = "LAUNDRY_RETRY_BASE_DELAY"
+	RetryMaxDelayEnv    = "LAUNDRY_RETRY_MAX_DELAY"
+	RetryJitterEnv      = "LAUNDRY_RETRY_JITTER"
+)
+
+// RetryPolicy decide cuántas veces y con qué espera se vuelve a despachar una orden
+type RetryPolicy struct {
+	MaxAttempts int           // Intentos fallidos antes de enviar la orden a la lista de fallidas
+	BaseDelay   time.Duration // Espera tras el primer fallo; se duplica en cada intento
+	MaxDelay    time.Duration // Tope de la espera exponencial
+	Jitter      float64       // Variación aleatoria relativa, p. ej. 0.2 = ±20 %
+	BusyDelay   time.Duration // Espera cuando todas las lavadoras están ocupadas
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   2 * time.Second,
+		MaxDelay:    1 * time.Minute,
+		Jitter:      0.2,
+		BusyDelay:   BusyWashersDelay,
+	}
+}
+
+// LoadRetryPolicy parte de la política por defecto y aplica las variables de entorno
+func LoadRetryPolicy() RetryPolicy {
+	policy := DefaultRetryPolicy()
+
+	if value := os.Getenv(RetryMaxAttemptsEnv); value != "" {
+		if attempts, err := strconv.Atoi(value); err == nil && attempts > 0 {
+			policy.MaxAttempts = attempts
+		} else {
+			fmt.Printf("Valor inválido en %s: %q\n", RetryMaxAttemptsEnv, value)
+		}
+	}
+	if value := os.Getenv(RetryBaseDelayEnv); value != "" {
+		if delay, err := time.ParseDuration(value); err == nil && delay > 0 {
+			policy.BaseDelay = delay
+		} else {
+			fmt.Printf("Valor inválido en %s: %q\n", RetryBaseDelayEnv, value)
+		}
+	}
+	if value := os.Getenv(RetryMaxDelayEnv); value != "" {
+		if delay, err := time.ParseDuration(value); err == nil && delay > 0 {
+			policy.MaxDelay = delay
+		} else {
+			fmt.Printf("Valor inválido en %s: %q\n", RetryMaxDelayEnv, value)
+		}
+	}
+	if value := os.Getenv(RetryJitterEnv); value != "" {
+		if jitter, err := strconv.ParseFloat(value, 64); err == nil && jitter >= 0 && jitter <= 1 {
+			policy.Jitter = jitter
+		} else {
+			fmt.Printf("Valor inválido en %s: %q\n", RetryJitterEnv, value)
+		}
+	}
+	return policy
+}
+
+// Backoff devuelve la espera antes del intento número attempt (empezando en 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		factor := 1 - p.Jitter + 2*p.Jitter*rand.Float64()
+		delay = time.Duration(float64(delay) * factor)
+	}
+	return delay
+}
+
+// FailureKind clasifica por qué no se pudo completar un despacho
+type FailureKind string
+
+const (
+	FailureBusy        FailureKind = "washers_busy"       // Todas las lavadoras ocupadas
+	FailureUnavailable FailureKind = "washer_unavailable" // Error de red o 5xx del servicio de lavadoras
+	FailureRejected    FailureKind = "rejected"           // El servicio de lavadoras rechazó la orden (4xx)
+	FailureWashFailed  FailureKind = "wash_failed"        // La lavadora no pudo terminar el ciclo
+	FailureJobLost     FailureKind = "job_lost"           // El trabajo desapareció del servicio de lavadoras o secadoras
+	FailureDryFailed   FailureKind = "dry_failed"         // La secadora no pudo terminar el ciclo
+	FailureWasherFault FailureKind = "washer_fault"       // La lavadora se descompuso o entró a mantenimiento
+	FailureOverweight  FailureKind = "cycle_overweight"   // El ciclo compartido no cupo en ninguna lavadora
+)
+
+// Retryable indica si tiene sentido volver a intentar el despacho
+func (k FailureKind) Retryable() bool {
+	return k != FailureRejected
+}
+
+// CountsAsAttempt indica si el fallo consume uno de los intentos de la política.
+// Encontrar las lavadoras ocupadas es la espera normal de la cola, no un fallo, y
+// un ciclo compartido que no cupo no es culpa de ninguna de sus órdenes.
+func (k FailureKind) CountsAsAttempt() bool {
+	return k != FailureBusy && k != FailureOverweight
+}
+
+// classifySubmitFailure interpreta el resultado de POST /jobs
+func classifySubmitFailure(status int) FailureKind {
+	switch {
+	case status == 0 || status >= http.StatusInternalServerError:
+		return FailureUnavailable
+	case status == http.StatusConflict || status == http.StatusTooManyRequests:
+		return FailureBusy
+	default:
+		return FailureRejected
+	}
+}
+
+// handleFailure aplica la política de reintentos: programa un nuevo despacho con
+// espera exponencial o, si se agotaron los intentos, deja la orden como fallida.
+func (ls *LaundryServer) handleFailure(order *LaundryOrder, kind FailureKind, reason string) {
+	current := ls.snapshot(order)
+	attempts := current.Attempts
+	if kind.CountsAsAttempt() {
+		attempts++
+	}
+
+	record := func(o *LaundryOrder) {
+		o.Attempts = attempts
+		o.LastError = reason
+		o.LastFailure = kind
+		o.JobID = ""
+		o.ResolvedProgram = ""
+		o.WashStage = ""
+	}
+
+	if !kind.Retryable() || attempts >= ls.retry.MaxAttempts {
+		fmt.Printf("Orden ID %d enviada a la lista de fallidas tras %d intentos: %s\n", order.ID, attempts, reason)
+		ls.transition(order, StateFailed, fmt.Sprintf("%s: %s", kind, reason), record)
+		return
+	}
+
+	delay := ls.retry.BusyDelay
+	if kind.CountsAsAttempt() {
+		delay = ls.retry.Backoff(attempts)
+	}
+	nextAttempt := clock.Now().Add(delay)
+
+	err := ls.transition(order, StateRetrying, fmt.Sprintf("%s: %s", kind, reason), func(o *LaundryOrder) {
+		record(o)
+		o.NextAttemptAt = &nextAttempt
+	})
+	if err != nil {
+		return
+	}
+
+	if kind.CountsAsAttempt() {
+		fmt.Printf("Orden ID %d: intento %d de %d fallido (%s). Nuevo intento en %s\n",
+			order.ID, attempts, ls.retry.MaxAttempts, kind, delay.Round(time.Millisecond))
+	}
+	clock.AfterFunc(delay, func() {
+		ls.releaseRetry(order)
+	})
+}
+
+// claimJob indica que quien llama se hace cargo del fallo del trabajo jobID. Como
+// lo pueden detectar a la vez el seguimiento del trabajo y el aviso de falla de la
+// lavadora, solo el primero obtiene true y los demás deben ignorarlo.
+func (ls *LaundryServer) claimJob(order *LaundryOrder, jobID string) bool {
+	ls.orderMutex.Lock()
+	defer ls.orderMutex.Unlock()
+
+	if order.JobID != jobID {
+		return false
+	}
+	order.JobID = ""
+	return true
+}
+
+// HandleWasherFault atiende el aviso de que una lavadora salió de servicio con un
+// trabajo en curso: las órdenes del ciclo vuelven a la cola sin esperar a la
+// siguiente consulta. Devuelve las órdenes afectadas.
+func (ls *LaundryServer) HandleWasherFault(washer string, jobID string, fault string) []LaundryOrder {
+	ls.orderMutex.Lock()
+	var affected []*LaundryOrder
+	for _, candidate := range ls.orders {
+		if candidate.JobID == jobID && (candidate.Status == StateDispatched || candidate.Status == StateWashing) {
+			affected = append(affected, candidate)
+		}
+	}
+	ls.orderMutex.Unlock()
+
+	var handled []LaundryOrder
+	for _, order := range affected {
+		if !ls.claimJob(order, jobID) {
+			continue
+		}
+		fmt.Printf("La lavadora %s salió de servicio (%s) con la orden ID %d\n", washer, fault, order.ID)
+		ls.handleFailure(order, FailureWasherFault, fmt.Sprintf("La lavadora %s salió de servicio: %s", washer, fault))
+		handled = append(handled, ls.snapshot(order))
+	}
+	return handled
+}
+
+// releaseRetry devuelve a la cola una orden que terminó su espera de reintento.
+// Si mientras tanto se canceló, no hace nada.
+func (ls *LaundryServer) releaseRetry(order *LaundryOrder) {
+	if ls.snapshot(order).Status != StateRetrying {
+		return
+	}
+	if err := ls.transition(order, StatePending, "Reencolada", func(o *LaundryOrder) {
+		o.NextAttemptAt = nil
+	}); err != nil {
+		return
+	}
+	ls.enqueue(order)
+}
+
+// RetryOrder saca una orden de la lista de fallidas y la vuelve a encolar con los
+// intentos reiniciados
+func (ls *LaundryServer) RetryOrder(id int) (LaundryOrder, error) {
+	ls.orderMutex.Lock()
+	order := ls.findOrder(id)
+	ls.orderMutex.Unlock()
+	if order == nil {
+		return LaundryOrder{}, errOrderNotFound
+	}
+
+	// Retrying también es alcanzable desde estados activos; aquí solo vale desde Failed
+	if current := ls.snapshot(order); current.Status != StateFailed {
+		return current, &InvalidTransitionError{OrderID: id, From: current.Status, To: StateRetrying}
+	}
+
+	err := ls.transition(order, StateRetrying, "Reintento manual", func(o *LaundryOrder) {
+		o.Attempts = 0
+	})
+	if err != nil {
+		return ls.snapshot(order), err
+	}
+	ls.releaseRetry(order)
+	return ls.snapshot(order), nil
+}
+
+// FailedOrders devuelve la lista de órdenes fallidas (dead-letter)
+func (ls *LaundryServer) FailedOrders() []LaundryOrder {
+	ls.orderMutex.Lock()
+	defer ls.orderMutex.Unlock()
+
+	failed := []LaundryOrder{}
+	for _, order := range ls.orders {
+		if order.Status == StateFailed {
+			failed = append(failed, *order)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+// AgingInterval es el tiempo de espera que suma un punto de prioridad a una orden.
+// Así una orden de baja prioridad termina superando a las que llegan después.
+const AgingInterval = 10 * time.Second
+
+// MaxPriority es la mayor prioridad que acepta una orden. Con este tope
+// prioridad*AgingInterval no se desborda al comparar órdenes en el heap.
+const MaxPriority = 1000
+
+// queuedOrder envuelve una orden mientras espera en la cola de despacho
+type queuedOrder struct {
+	order      *LaundryOrder
+	priority   int
+	loadType   int
+	enqueuedAt time.Time
+	seq        uint64
+	index      int
+}
+
+// effectivePriority devuelve la prioridad de la orden más el envejecimiento acumulado
+func (q *queuedOrder) effectivePriority(now time.Time, aging time.Duration) float64 {
+	return float64(q.priority) + float64(now.Sub(q.enqueuedAt))/float64(aging)
+}
+
+// orderHeap implementa heap.Interface. Un número de prioridad mayor se despacha antes.
+// Como el envejecimiento es lineal y avanza igual para todas las órdenes, comparar
+// prioridad*aging contra la diferencia de llegada da el mismo orden en cualquier
+// instante, por lo que el heap nunca necesita reordenarse con el paso del tiempo.
+type orderHeap struct {
+	items []*queuedOrder
+	aging time.Duration
+}
+
+func (h *orderHeap) Len() int { return len(h.items) }
+
+func (h *orderHeap) Less(i, j int) bool {
+	return h.before(h.items[i], h.items[j])
+}
+
+func (h *orderHeap) before(a, b *queuedOrder) bool {
+	priorityGap := time.Duration(a.priority-b.priority) * h.aging
+	arrivalGap := a.enqueuedAt.Sub(b.enqueuedAt)
+	if priorityGap != arrivalGap {
+		return priorityGap > arrivalGap
+	}
+	return a.seq < b.seq
+}
+
+func (h *orderHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *orderHeap) Push(x any) {
+	item := x.(*queuedOrder)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *orderHeap) Pop() any {
+	old := h.items
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	h.items = old[:n-1]
+	return item
+}
+
+// QueueEntry describe una orden en espera tal como la expone GET /queue
+type QueueEntry struct {
+	Position          int     `json:"position"`
+	OrderID           int     `json:"order_id"`
+	LoadType          int     `json:"load_type"`
+	Priority          int     `json:"priority"`
+	EffectivePriority float64 `json:"effective_priority"`
+	WaitingSeconds    float64 `json:"waiting_seconds"`
+}
+
+// OrderScheduler es la cola de despacho con prioridad y envejecimiento. El límite
+// solo se aplica al admitir órdenes nuevas (ver Full); las órdenes que vuelven a
+// la cola por un reintento siempre entran para no perderse.
+type OrderScheduler struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	heap     orderHeap
+	limit    int
+	seq      uint64
+}
+
+func NewOrderScheduler(limit int, aging time.Duration) *OrderScheduler {
+	s := &OrderScheduler{
+		heap:  orderHeap{aging: aging},
+		limit: limit,
+	}
+	s.notEmpty = sync.NewCond(&s.mu)
+	return s
+}
+
+// Push agrega una orden a la cola sin bloquear. La prioridad y el tipo de carga se
+// reciben aparte porque el llamador los lee bajo su candado.
+func (s *OrderScheduler) Push(order *LaundryOrder, priority int, loadType int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	heap.Push(&s.heap, &queuedOrder{
+		order:      order,
+		priority:   priority,
+		loadType:   loadType,
+		enqueuedAt: clock.Now(),
+		seq:        s.seq,
+	})
+	s.notEmpty.Signal()
+}
+
+// take saca la orden con mayor prioridad efectiva; bloquea mientras la cola esté
+// vacía. Devuelve la entrada completa para poder devolverla con putBack.
+func (s *OrderScheduler) take() *queuedOrder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.heap.items) == 0 {
+		s.notEmpty.Wait()
+	}
+	return heap.Pop(&s.heap).(*queuedOrder)
+}
+
+// putBack devuelve a la cola una entrada sacada con take. Conserva su hora de
+// llegada y su turno, así que la orden no pierde envejecimiento.
+func (s *OrderScheduler) putBack(item *queuedOrder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	heap.Push(&s.heap, item)
+	s.notEmpty.Signal()
+}
+
+// find devuelve la posición en el heap de la orden o -1; requiere s.mu tomado
+func (s *OrderScheduler) find(orderID int) int {
+	for i, item := range s.heap.items {
+		if item.order.ID == orderID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Remove saca una orden de la cola. Devuelve false si no estaba en espera.
+func (s *OrderScheduler) Remove(orderID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(orderID)
+	if i < 0 {
+		return false
+	}
+	heap.Remove(&s.heap, i)
+	return true
+}
+
+// Update cambia la prioridad y el tipo de carga de una orden en espera y la
+// reubica en el heap. Conserva su hora de llegada, así que no pierde envejecimiento.
+func (s *OrderScheduler) Update(orderID int, priority int, loadType int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(orderID)
+	if i < 0 {
+		return false
+	}
+	item := s.heap.items[i]
+	item.priority = priority
+	item.loadType = loadType
+	heap.Fix(&s.heap, i)
+	return true
+}
+
+// Len devuelve el número de órdenes en espera
+func (s *OrderScheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.heap.items)
+}
+
+// Limit devuelve el máximo de órdenes en espera que se admiten
+func (s *OrderScheduler) Limit() int {
+	return s.limit
+}
+
+// Full indica si la cola alcanzó el límite de admisión
+func (s *OrderScheduler) Full() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.heap.items) >= s.limit
+}
+
+// Snapshot devuelve las órdenes en espera en el orden en que serían despachadas
+func (s *OrderScheduler) Snapshot() []QueueEntry {
+	s.mu.Lock()
+	items := make([]*queuedOrder, len(s.heap.items))
+	for i, item := range s.heap.items {
+		copied := *item
+		items[i] = &copied
+	}
+	s.mu.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.heap.before(items[i], items[j])
+	})
+
+	now := clock.Now()
+	entries := make([]QueueEntry, len(items))
+	for i, item := range items {
+		entries[i] = QueueEntry{
+			Position:          i + 1,
+			OrderID:           item.order.ID,
+			LoadType:          item.loadType,
+			Priority:          item.priority,
+			EffectivePriority: item.effectivePriority(now, s.heap.aging),
+			WaitingSeconds:    now.Sub(item.enqueuedAt).Seconds(),
+		}
+	}
+	return entries
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// OrderState es la etapa del ciclo de vida de una orden
+type OrderState string
+
+const (
+	StatePending    OrderState = "pending"    // En la cola esperando lavadora
+	StateDispatched OrderState = "dispatched" // Enviada al servicio de lavadoras
+	StateWashing    OrderState = "washing"    // La lavadora está en el ciclo de lavado
+	StateDrying     OrderState = "drying"     // Lavada; en la secadora o esperando una
+	StateCompleted  OrderState = "completed"
+	StateFailed     OrderState = "failed"
+	StateCancelled  OrderState = "cancelled"
+	StateRetrying   OrderState = "retrying" // Rechazada o interrumpida; volverá a la cola
+)
+
+// orderTransitions enumera los estados a los que se puede pasar desde cada estado
+var orderTransitions = map[OrderState][]OrderState{
+	StatePending:    {StateDispatched, StateDrying, StateCancelled},
+	StateDispatched: {StateWashing, StateDrying, StateRetrying, StateFailed, StateCancelled},
+	StateWashing:    {StateDrying, StateRetrying, StateFailed, StateCancelled},
+	StateDrying:     {StateCompleted, StateRetrying, StateFailed, StateCancelled},
+	StateRetrying:   {StatePending, StateFailed, StateCancelled},
+	StateFailed:     {StateRetrying},
+	StateCompleted:  {},
+	StateCancelled:  {},
+}
+
+// CanTransition indica si la tabla de transiciones permite pasar a next
+func (s OrderState) CanTransition(next OrderState) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Terminal indica que la orden ya no puede cambiar de estado
+func (s OrderState) Terminal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+// legacyStates traduce los estados en texto libre que guardaban versiones anteriores
+var legacyStates = map[string]OrderState{
+	"Pendiente":  StatePending,
+	"En Proceso": StateWashing,
+	"Completado": StateCompleted,
+	"Error":      StateFailed,
+}
+
+// normalizeState convierte un estado heredado a su equivalente tipado
+func normalizeState(state OrderState) OrderState {
+	if mapped, ok := legacyStates[string(state)]; ok {
+		return mapped
+	}
+	return state
+}
+
+// StateTransition es una entrada del historial de una orden
+type StateTransition struct {
+	From   OrderState `json:"from,omitempty"`
+	To     OrderState `json:"to"`
+	At     time.Time  `json:"at"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+// InvalidTransitionError se devuelve al intentar una transición fuera de la tabla
+type InvalidTransitionError struct {
+	OrderID int
+	From    OrderState
+	To      OrderState
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("la orden ID %d no puede pasar de %s a %s", e.OrderID, e.From, e.To)
+}
+
+// transitionTo valida y aplica el cambio de estado registrándolo en el historial
+func (o *LaundryOrder) transitionTo(next OrderState, reason string, at time.Time) error {
+	if !o.Status.CanTransition(next) {
+		return &InvalidTransitionError{OrderID: o.ID, From: o.Status, To: next}
+	}
+	o.History = append(o.History, StateTransition{From: o.Status, To: next, At: at, Reason: reason})
+	o.Status = next
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	OrderStoreEnv         = "LAUNDRY_STORE" // Ruta del archivo de órdenes; "memory" desactiva la persistencia
+	DefaultOrderStorePath = "laundry_orders.jsonl"
+)
+
+// OrderStore guarda las órdenes para que sobrevivan a un reinicio del servicio
+type OrderStore interface {
+	// Load devuelve la última versión conocida de cada orden, ordenadas por ID
+	Load() ([]LaundryOrder, error)
+	// Save registra el estado actual de una orden
+	Save(order LaundryOrder) error
+	Close() error
+}
+
+// OpenOrderStore elige la implementación según la variable de entorno LAUNDRY_STORE
+func OpenOrderStore() (OrderStore, error) {
+	path := os.Getenv(OrderStoreEnv)
+	switch path {
+	case "memory":
+		return NewMemoryOrderStore(), nil
+	case "":
+		path = DefaultOrderStorePath
+	}
+	return OpenFileOrderStore(path)
+}
+
+// MemoryOrderStore conserva las órdenes solo mientras el proceso está vivo
+type MemoryOrderStore struct {
+	mu     sync.Mutex
+	orders map[int]LaundryOrder
+}
+
+func NewMemoryOrderStore() *MemoryOrderStore {
+	return &MemoryOrderStore{orders: map[int]LaundryOrder{}}
+}
+
+func (s *MemoryOrderStore) Load() ([]LaundryOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedOrders(s.orders), nil
+}
+
+func (s *MemoryOrderStore) Save(order LaundryOrder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders[order.ID] = order
+	return nil
+}
+
+func (s *MemoryOrderStore) Close() error {
+	return nil
+}
+
+// FileOrderStore es un registro de solo anexado: cada cambio de una orden agrega
+// una línea JSON con su estado completo y al abrir gana la última línea de cada ID.
+// El archivo se compacta en cada arranque para que no crezca sin límite.
+type FileOrderStore struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	orders []LaundryOrder
+}
+
+func OpenFileOrderStore(path string) (*FileOrderStore, error) {
+	latest, err := replayOrderLog(path)
+	if err != nil {
+		return nil, err
+	}
+	orders := sortedOrders(latest)
+
+	if err := compactOrderLog(path, orders); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileOrderStore{path: path, file: file, orders: orders}, nil
+}
+
+func (s *FileOrderStore) Load() ([]LaundryOrder, error) {
+	orders := make([]LaundryOrder, len(s.orders))
+	copy(orders, s.orders)
+	return orders, nil
+}
+
+func (s *FileOrderStore) Save(order LaundryOrder) error {
+	line, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileOrderStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// replayOrderLog lee el registro y se queda con la última versión de cada orden.
+// Una línea corrupta al final (p. ej. por un corte durante la escritura) se descarta;
+// una corrupta en medio del registro es un error, porque la compactación borraría
+// lo que se perdió.
+func replayOrderLog(path string) (map[int]LaundryOrder, error) {
+	latest := map[int]LaundryOrder{}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return latest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber, corruptLine := 0, 0
+	var corruptErr error
+	for scanner.Scan() {
+		lineNumber++
+		if corruptLine != 0 {
+			return nil, fmt.Errorf("%s: la línea %d está corrupta y no es la última: %v", path, corruptLine, corruptErr)
+		}
+		var order LaundryOrder
+		if err := json.Unmarshal(scanner.Bytes(), &order); err != nil {
+			corruptLine, corruptErr = lineNumber, err
+			continue
+		}
+		latest[order.ID] = order
+	}
+	if corruptLine != 0 {
+		fmt.Printf("Se descartó la última línea (%d) de %s: %v\n", corruptLine, path, corruptErr)
+	}
+	return latest, scanner.Err()
+}
+
+// compactOrderLog reescribe el registro con una línea por orden usando un archivo temporal
+func compactOrderLog(path string, orders []LaundryOrder) error {
+	tmpPath := path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, order := range orders {
+		if err := encoder.Encode(order); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func sortedOrders(orders map[int]LaundryOrder) []LaundryOrder {
+	result := make([]LaundryOrder, 0, len(orders))
+	for _, order := range orders {
+		result = append(result, order)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+const (
+	JobPollInterval = 1 * time.Second
+	MaxPollErrors   = 5 // Errores consecutivos tolerados antes de dar la orden por perdida
+)
+
+var (
+	errJobNotFound = errors.New("el trabajo no existe en el servicio de lavadoras")
+	errJobFinished = errors.New("el trabajo ya terminó")
+)
+
+// WashPrograms son los programas de lavado que ofrece el servicio de lavadoras
+var WashPrograms = []string{"cotton", "delicate", "eco", "heavy", "quick"}
+
+func validProgram(name string) bool {
+	for _, program := range WashPrograms {
+		if program == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CapacityError indica que una carga supera la de todas las lavadoras que admiten
+// su programa
+type CapacityError struct {
+	WeightKg float64
+	MaxKg    float64
+}
+
+func (e *CapacityError) Error() string {
+	return fmt.Sprintf("la carga de %.1f kg supera la capacidad de las lavadoras (%.1f kg)", e.WeightKg, e.MaxKg)
+}
+
+// washJob refleja la respuesta de POST /jobs y GET /jobs/:id del servicio de lavadoras
+type washJob struct {
+	ID       string  `json:"id"`
+	LoadType int     `json:"load_type"`
+	Program  string  `json:"program"`
+	WeightKg float64 `json:"weight_kg"`
+	Washer   string  `json:"washer"`
+	Phase    string  `json:"phase"`
+	Stage    string  `json:"stage"`
+	Fault    string  `json:"fault"`
+	Message  string  `json:"message"`
+	Error    string  `json:"error"`
+}
+
+func (j *washJob) finished() bool {
+	return j.Phase == "done" || j.Phase == "failed" || j.Phase == "aborted"
+}
+
+// submitWashJob crea un trabajo de lavado. Con weightKg en cero la carga ocupa la
+// lavadora completa. Devuelve el código HTTP para que el llamador distinga entre
+// lavadoras ocupadas y errores de red, y un *CapacityError si la carga no cabe en
+// ninguna lavadora.
+func submitWashJob(baseURL string, loadType int, program string, weightKg float64) (*washJob, int, error) {
+	query := url.Values{"load": {strconv.Itoa(loadType)}}
+	if program != "" {
+		query.Set("program", program)
+	}
+	if weightKg > 0 {
+		query.Set("kg", strconv.FormatFloat(weightKg, 'f', -1, 64))
+	}
+	resp, err := http.Post(baseURL+"/jobs?"+query.Encode(), "application/json", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		var rejection struct {
+			MaxKg float64 `json:"max_kg"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&rejection) == nil && rejection.MaxKg > 0 {
+			return nil, resp.StatusCode, &CapacityError{WeightKg: weightKg, MaxKg: rejection.MaxKg}
+		}
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, resp.StatusCode, fmt.Errorf("estado inesperado: %d", resp.StatusCode)
+	}
+
+	var job washJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return &job, resp.StatusCode, nil
+}
+
+// fetchWashJob consulta el estado actual de un trabajo de lavado
+func fetchWashJob(baseURL string, id string) (*washJob, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/jobs/%s", baseURL, id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errJobNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("estado inesperado: %d", resp.StatusCode)
+	}
+
+	var job washJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// abortJob pide al servicio de lavadoras o de secadoras detener un trabajo. Que
+// el trabajo ya no exista no es un error: no queda nada que abortar. Si ya había
+// terminado devuelve errJobFinished, porque su resultado sigue siendo válido.
+func abortJob(baseURL string, id string) error {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/jobs/%s", baseURL, id), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusConflict:
+		return errJobFinished
+	}
+	return fmt.Errorf("estado inesperado: %d", resp.StatusCode)
+}
+
+// waitForWashJob consulta el trabajo hasta que termine. onPhase se invoca cada
+// vez que el trabajo cambia de fase o de etapa del programa.
+func waitForWashJob(baseURL string, id string, onPhase func(job *washJob)) (*washJob, error) {
+	failures := 0
+	lastPhase, lastStage := "", ""
+	for {
+		clock.Sleep(JobPollInterval)
+
+		job, err := fetchWashJob(baseURL, id)
+		if errors.Is(err, errJobNotFound) {
+			return nil, err
+		}
+		if err != nil {
+			failures++
+			if failures >= MaxPollErrors {
+				return nil, fmt.Errorf("no se pudo consultar el trabajo %s: %v", id, err)
+			}
+			continue
+		}
+		failures = 0
+
+		if job.Phase != lastPhase || job.Stage != lastStage {
+			lastPhase, lastStage = job.Phase, job.Stage
+			if onPhase != nil {
+				onPhase(job)
+			}
+		}
+		if job.finished() {
+			return job, nil
+		}
+	}
+}
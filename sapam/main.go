@@ -1,50 +1,37 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+	"github.com/M1keTrike/LaundryAPI_Go/internal/stream"
 	"github.com/gin-gonic/gin"
 )
 
+// Bloque de agua que entrega SAPAM en cada segundo simulado
+const waterPerBlock = 10
+
 // Función que simula la generación de agua en bloques
 func deliverWater(c *gin.Context, quantity int) {
-	// Crear un canal para los bloques de agua
-	waterChan := make(chan string)
-
-	// Goroutine para generar agua
-	go func() {
-		for i := 0; i < quantity; i++ {
-			// Esperar 1 segundo por bloque
-			time.Sleep(1 * time.Second)
-
-			// Enviar un bloque de agua al canal
-			waterChan <- "{ \"water\": 10}\n"
-		}
-		close(waterChan) // Cerrar el canal al finalizar
-	}()
-
-	// Configurar la respuesta como chunked
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.Header().Set("Transfer-Encoding", "chunked")
-	c.Writer.WriteHeader(http.StatusOK)
-
-	// Transmitir los bloques de agua
-	for block := range waterChan {
-		_, err := c.Writer.Write([]byte(block))
-		if err != nil {
-			fmt.Println("Error escribiendo al cliente:", err)
-			break
-		}
-		// Asegurar que se envíen los datos inmediatamente
-		c.Writer.Flush()
+	summary := stream.Serve(c.Request.Context(), c.Writer, stream.Water, quantity*waterPerBlock, quantity, 1*time.Second,
+		func(context.Context, int) (int, stream.Reason) { return waterPerBlock, "" })
+	if summary.Reason != stream.ReasonCompleted {
+		fmt.Printf("Entrega de agua interrumpida (%s): %d de %d unidades\n", summary.Reason, summary.Delivered, summary.Requested)
 	}
 }
 
 func main() {
+	if err := clock.Setup(); err != nil {
+		log.Fatalf("Configuración del reloj inválida: %v", err)
+	}
+
 	r := gin.Default()
+	clock.RegisterRoutes(r)
 
 	r.GET("/water", func(c *gin.Context) {
 		// Leer el parámetro "quantity" de la URL
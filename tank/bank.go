@@ -0,0 +1,486 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	BankConfigEnv         = "TANK_BANK_CONFIG" // Ruta del archivo YAML con el banco de tanques
+	DefaultBankConfigPath = "tanks.yaml"
+
+	SourceSAPAM = "sapam" // El tanque se recarga desde SAPAM
+	SourceNone  = "none"  // El tanque no se recarga solo
+)
+
+// SupplyPolicy decide de qué tanque sale cada bloque que se suministra
+type SupplyPolicy string
+
+const (
+	PolicyFillFirst SupplyPolicy = "fill_first" // Vacía los tanques en el orden del banco
+	PolicyBalanced  SupplyPolicy = "balanced"   // Toma del tanque con mayor porcentaje de llenado
+	PolicyPriority  SupplyPolicy = "priority"   // Toma del tanque con mayor prioridad (número menor)
+
+	DefaultPolicy = PolicyFillFirst
+)
+
+var policies = []SupplyPolicy{PolicyFillFirst, PolicyBalanced, PolicyPriority}
+
+func validPolicy(policy SupplyPolicy) bool {
+	for _, known := range policies {
+		if known == policy {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	errUnknownTank     = errors.New("tanque no encontrado")
+	errSameTank        = errors.New("el origen y el destino son el mismo tanque")
+	errNotEnoughWater  = errors.New("no hay suficiente agua en el tanque de origen")
+	errNoRoom          = errors.New("el tanque de destino no tiene espacio suficiente")
+	errBankOutOfSupply = errors.New("ningún tanque tiene agua suficiente")
+	errBankReserved    = errors.New("el banco no tiene suficiente agua sin reservar")
+)
+
+// TankConfig describe un tanque del banco. Los campos en cero toman el valor de
+// la sección defaults del archivo.
+type TankConfig struct {
+	Name          string        `yaml:"name" json:"name"`
+	MaxCapacity   int16         `yaml:"max_capacity" json:"max_capacity"`
+	LowWatermark  int16         `yaml:"low_watermark" json:"low_watermark"`   // Por defecto, un bloque menos que max_capacity
+	HighWatermark int16         `yaml:"high_watermark" json:"high_watermark"` // Por defecto, max_capacity
+	RefillWindows []string      `yaml:"refill_windows" json:"refill_windows,omitempty"`
+	BackoffMin    time.Duration `yaml:"backoff_min" json:"-"`
+	BackoffMax    time.Duration `yaml:"backoff_max" json:"-"`
+	Priority      int           `yaml:"priority" json:"priority"`
+	Source        string        `yaml:"source" json:"source"` // sapam, none o el nombre de otro tanque
+}
+
+// BankConfig es el contenido del archivo de configuración del banco
+type BankConfig struct {
+	Policy   SupplyPolicy `yaml:"policy"`
+	Defaults TankConfig   `yaml:"defaults"`
+	Tanks    []TankConfig `yaml:"tanks"`
+
+	// Quienes piden agua con /supply, identificados por la cabecera X-Consumer
+	ScarcityLevel    int              `yaml:"scarcity_level"`     // Nivel del banco por debajo del cual manda la prioridad
+	MaxAutoConsumers int              `yaml:"max_auto_consumers"` // Consumidores no configurados que se registran como máximo
+	AutoConsumerTTL  time.Duration    `yaml:"auto_consumer_ttl"`  // Inactividad tras la que se olvidan
+	ConsumerDefaults ConsumerConfig   `yaml:"consumer_defaults"`
+	Consumers        []ConsumerConfig `yaml:"consumers"`
+}
+
+func builtinDefaults() TankConfig {
+	return TankConfig{
+		MaxCapacity: MAX_CAPACITY,
+		BackoffMin:  DefaultBackoffMin,
+		BackoffMax:  DefaultBackoffMax,
+		Source:      SourceSAPAM,
+	}
+}
+
+// builtinBank se usa cuando no hay archivo de configuración: un solo tanque como
+// el que tenía el servicio originalmente
+func builtinBank() BankConfig {
+	return BankConfig{Tanks: []TankConfig{{Name: "main"}}}
+}
+
+// withDefaults completa los campos vacíos con los de defaults
+func (c TankConfig) withDefaults(defaults TankConfig) TankConfig {
+	if c.MaxCapacity == 0 {
+		c.MaxCapacity = defaults.MaxCapacity
+	}
+	if c.LowWatermark == 0 {
+		c.LowWatermark = defaults.LowWatermark
+	}
+	if c.HighWatermark == 0 {
+		c.HighWatermark = defaults.HighWatermark
+	}
+	if c.RefillWindows == nil {
+		c.RefillWindows = defaults.RefillWindows
+	}
+	if c.BackoffMin == 0 {
+		c.BackoffMin = defaults.BackoffMin
+	}
+	if c.BackoffMax == 0 {
+		c.BackoffMax = defaults.BackoffMax
+	}
+	if c.Source == "" {
+		c.Source = defaults.Source
+	}
+	return c
+}
+
+// withWatermarks pone las marcas que siguen vacías según la capacidad del tanque:
+// como el tanque original, recarga en cuanto le falta un bloque y hasta llenarse
+func (c TankConfig) withWatermarks() TankConfig {
+	if c.HighWatermark == 0 {
+		c.HighWatermark = c.MaxCapacity
+	}
+	if c.LowWatermark == 0 {
+		c.LowWatermark = c.MaxCapacity - (MAX_CAPACITY - REFILL_THRESHOLD)
+	}
+	return c
+}
+
+func (c TankConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("el tanque necesita un nombre")
+	}
+	if c.Name == SourceSAPAM || c.Name == SourceNone {
+		return fmt.Errorf("%s: el nombre está reservado", c.Name)
+	}
+	if c.MaxCapacity < BLOCK_SIZE {
+		return fmt.Errorf("%s: max_capacity debe ser al menos %d", c.Name, BLOCK_SIZE)
+	}
+	if c.LowWatermark <= 0 || c.LowWatermark >= c.HighWatermark || c.HighWatermark > c.MaxCapacity {
+		return fmt.Errorf("%s: las marcas deben cumplir 0 < low_watermark < high_watermark <= max_capacity", c.Name)
+	}
+	for _, window := range c.RefillWindows {
+		if _, err := parseRefillWindow(window); err != nil {
+			return fmt.Errorf("%s: %v", c.Name, err)
+		}
+	}
+	if c.BackoffMin <= 0 || c.BackoffMax < c.BackoffMin {
+		return fmt.Errorf("%s: backoff_min debe ser positivo y no mayor que backoff_max", c.Name)
+	}
+	if c.Priority < 0 {
+		return fmt.Errorf("%s: priority no puede ser negativa", c.Name)
+	}
+	return nil
+}
+
+// LoadBankConfig lee el banco del archivo indicado en TANK_BANK_CONFIG o de
+// tanks.yaml. Si no se indicó archivo y no existe, usa un solo tanque.
+func LoadBankConfig() (BankConfig, error) {
+	path := os.Getenv(BankConfigEnv)
+	explicit := path != ""
+	if !explicit {
+		path = DefaultBankConfigPath
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		fmt.Printf("No se encontró %s; se usará un solo tanque\n", path)
+		return builtinBank(), nil
+	}
+	if err != nil {
+		return BankConfig{}, err
+	}
+
+	var config BankConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return BankConfig{}, fmt.Errorf("%s: %v", path, err)
+	}
+	fmt.Printf("Banco cargado de %s: %d tanques\n", path, len(config.Tanks))
+	return config, nil
+}
+
+// Bank es el conjunto de tanques del servicio. mu ordena los suministros y las
+// transferencias para que dos peticiones no elijan a la vez la última agua de un
+// tanque; las recargas desde SAPAM solo toman el candado de cada tanque.
+type Bank struct {
+	mu       sync.Mutex
+	tanks    []*Tank
+	policy   SupplyPolicy
+	reserved int // Agua apartada por reservas; Draw no la entrega
+}
+
+func NewBank(config BankConfig) (*Bank, error) {
+	defaults := config.Defaults.withDefaults(builtinDefaults())
+	b := &Bank{policy: DefaultPolicy}
+	if config.Policy != "" {
+		if err := b.SetPolicy(config.Policy); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, tankConfig := range config.Tanks {
+		tankConfig = tankConfig.withDefaults(defaults).withWatermarks()
+		if err := tankConfig.validate(); err != nil {
+			return nil, err
+		}
+		if b.Get(tankConfig.Name) != nil {
+			return nil, fmt.Errorf("el tanque %s está repetido", tankConfig.Name)
+		}
+		b.tanks = append(b.tanks, newTank(tankConfig))
+	}
+	if len(b.tanks) == 0 {
+		return nil, fmt.Errorf("el banco no tiene tanques")
+	}
+
+	for _, tank := range b.tanks {
+		if err := b.validateSource(tank); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// validateSource comprueba que la cadena de recarga del tanque termine en SAPAM
+// o en un tanque que no se recarga, sin volver sobre sí misma
+func (b *Bank) validateSource(tank *Tank) error {
+	visited := map[string]bool{tank.name: true}
+	for current := tank; current.source != SourceSAPAM && current.source != SourceNone; {
+		next := b.Get(current.source)
+		if next == nil {
+			return fmt.Errorf("%s: source debe ser %q, %q o el nombre de otro tanque, no %q", current.name, SourceSAPAM, SourceNone, current.source)
+		}
+		if visited[next.name] {
+			return fmt.Errorf("%s: la cadena de recarga forma un ciclo", tank.name)
+		}
+		visited[next.name] = true
+		current = next
+	}
+	return nil
+}
+
+var bank *Bank
+
+// All devuelve los tanques en el orden del banco
+func (b *Bank) All() []*Tank {
+	tanks := make([]*Tank, len(b.tanks))
+	copy(tanks, b.tanks)
+	return tanks
+}
+
+// Get devuelve el tanque con ese nombre o nil
+func (b *Bank) Get(name string) *Tank {
+	for _, tank := range b.tanks {
+		if tank.name == name {
+			return tank
+		}
+	}
+	return nil
+}
+
+func (b *Bank) Policy() SupplyPolicy {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.policy
+}
+
+func (b *Bank) SetPolicy(policy SupplyPolicy) error {
+	if !validPolicy(policy) {
+		return fmt.Errorf("política de suministro desconocida %q", policy)
+	}
+	b.mu.Lock()
+	b.policy = policy
+	b.mu.Unlock()
+	return nil
+}
+
+// Totals suma el agua y la capacidad de todos los tanques
+func (b *Bank) Totals() (level int, max int) {
+	for _, tank := range b.tanks {
+		level += int(tank.GetCapacity())
+		max += int(tank.maxCapacity)
+	}
+	return level, max
+}
+
+// Inlet devuelve el tanque que recibe el agua de /fill: el primero alimentado por
+// SAPAM que tenga espacio, o el primero alimentado por SAPAM si todos están llenos
+func (b *Bank) Inlet() *Tank {
+	var first *Tank
+	for _, tank := range b.tanks {
+		if tank.source != SourceSAPAM {
+			continue
+		}
+		if first == nil {
+			first = tank
+		}
+		if tank.freeRoom() >= BLOCK_SIZE {
+			return tank
+		}
+	}
+	return first
+}
+
+// Draw descuenta amount del tanque que indique la política sin tocar el agua
+// reservada. Si ningún tanque tiene amount, entrega lo que quede en el más lleno.
+// Devuelve el tanque y lo que se sacó de él.
+func (b *Bank) Draw(amount int16) (*Tank, int16, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	level, _ := b.Totals()
+	amount = int16(min(int(amount), level-b.reserved))
+	if amount <= 0 {
+		return nil, 0, errBankOutOfSupply
+	}
+	return b.drawLocked(amount)
+}
+
+// DrawReserved descuenta amount del agua que ya estaba reservada
+func (b *Bank) DrawReserved(amount int16) (*Tank, int16, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tank, amount, err := b.drawLocked(int16(min(int(amount), b.reserved)))
+	b.reserved -= int(amount)
+	return tank, amount, err
+}
+
+// drawLocked saca amount del tanque que indique la política o, si ninguno lo
+// tiene, lo que quede en el más lleno; requiere b.mu tomado
+func (b *Bank) drawLocked(amount int16) (*Tank, int16, error) {
+	tank := b.chooseLocked(amount)
+	if tank == nil {
+		tank, amount = b.fullestLocked()
+	}
+	if tank == nil || amount <= 0 {
+		return nil, 0, errBankOutOfSupply
+	}
+	if err := tank.UseWater(amount); err != nil {
+		return nil, 0, err
+	}
+	return tank, amount, nil
+}
+
+// Reserve aparta amount unidades para que Draw no las entregue
+func (b *Bank) Reserve(amount int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	level, _ := b.Totals()
+	if level-b.reserved < amount {
+		return errBankReserved
+	}
+	b.reserved += amount
+	return nil
+}
+
+// Unreserve devuelve al suministro normal amount unidades reservadas
+func (b *Bank) Unreserve(amount int) {
+	b.mu.Lock()
+	b.reserved = max(b.reserved-amount, 0)
+	b.mu.Unlock()
+}
+
+// Reserved devuelve el agua apartada por reservas
+func (b *Bank) Reserved() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reserved
+}
+
+// fullestLocked devuelve el tanque con más agua y su nivel; requiere b.mu tomado
+func (b *Bank) fullestLocked() (*Tank, int16) {
+	var fullest *Tank
+	var level int16
+	for _, tank := range b.tanks {
+		if current := tank.GetCapacity(); current > level {
+			fullest, level = tank, current
+		}
+	}
+	return fullest, level
+}
+
+// chooseLocked aplica la política entre los tanques que tienen al menos amount;
+// requiere b.mu tomado
+func (b *Bank) chooseLocked(amount int16) *Tank {
+	var chosen *Tank
+	var chosenRatio float64
+	for _, tank := range b.tanks {
+		level := tank.GetCapacity()
+		if level < amount {
+			continue
+		}
+		ratio := float64(level) / float64(tank.maxCapacity)
+
+		switch {
+		case chosen == nil:
+		case b.policy == PolicyBalanced && ratio > chosenRatio:
+		case b.policy == PolicyPriority && tank.priority < chosen.priority:
+		default:
+			continue
+		}
+		chosen, chosenRatio = tank, ratio
+		if b.policy == PolicyFillFirst {
+			break
+		}
+	}
+	return chosen
+}
+
+// Transfer pasa amount unidades de un tanque a otro
+func (b *Bank) Transfer(fromName string, toName string, amount int16) error {
+	from, to := b.Get(fromName), b.Get(toName)
+	if from == nil || to == nil {
+		return errUnknownTank
+	}
+	if from == to {
+		return errSameTank
+	}
+
+	// Solo Transfer toma dos tanques a la vez y b.mu impide que haya dos transferencias
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	from.mutex.Lock()
+	defer from.mutex.Unlock()
+	to.mutex.Lock()
+	defer to.mutex.Unlock()
+
+	if to.maxCapacity-to.capacity < amount {
+		return errNoRoom
+	}
+	if from.capacity < amount {
+		return errNotEnoughWater
+	}
+	from.capacity -= amount
+	from.flow.TransferOut += int(amount)
+	to.capacity += amount
+	to.flow.TransferIn += int(amount)
+	fmt.Printf("Se transfirieron %d unidades de %s a %s\n", amount, from.name, to.name)
+	return nil
+}
+
+// TankStatus es la vista de un tanque en /tanks
+type TankStatus struct {
+	TankConfig
+	Capacity    int16       `json:"capacity"` // Agua que contiene el tanque
+	FillRatio   float64     `json:"fill_ratio"`
+	RefillState RefillState `json:"refill_state"`
+}
+
+func (t *Tank) status() TankStatus {
+	level := t.GetCapacity()
+	t.refill.mu.Lock()
+	state := t.refill.state
+	t.refill.mu.Unlock()
+	var windows []string
+	for _, window := range t.windows {
+		windows = append(windows, window.String())
+	}
+	return TankStatus{
+		TankConfig: TankConfig{
+			Name:          t.name,
+			MaxCapacity:   t.maxCapacity,
+			LowWatermark:  t.lowWatermark,
+			HighWatermark: t.highWatermark,
+			RefillWindows: windows,
+			Priority:      t.priority,
+			Source:        t.source,
+		},
+		Capacity:    level,
+		FillRatio:   float64(level) / float64(t.maxCapacity),
+		RefillState: state,
+	}
+}
+
+// Status devuelve el estado de todos los tanques
+func (b *Bank) Status() []TankStatus {
+	statuses := make([]TankStatus, len(b.tanks))
+	for i, tank := range b.tanks {
+		statuses[i] = tank.status()
+	}
+	return statuses
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+const (
+	AnonymousConsumer     = "anonymous"     // Nombre de quien pide agua sin la cabecera X-Consumer
+	DefaultQuotaPeriod    = 24 * time.Hour  // Periodo de la cuota si no se indica
+	ScarcityCheckInterval = 1 * time.Second // Cada cuánto reintenta un consumidor relegado por prioridad
+	DefaultPriority       = 5               // Prioridad de los consumidores no configurados
+	scarcityFraction      = 0.2             // Sin scarcity_level, escasez es bajar del 20 % del banco
+
+	DefaultMaxAutoConsumers = 32            // Consumidores no configurados que se registran como máximo
+	DefaultAutoConsumerTTL  = 1 * time.Hour // Inactividad tras la que se olvida un consumidor no configurado
+)
+
+// ConsumerConfig describe los límites de un consumidor del tanque. Los campos en
+// cero toman el valor de consumer_defaults.
+type ConsumerConfig struct {
+	Name        string        `yaml:"name" json:"name"`
+	Priority    int           `yaml:"priority" json:"priority"` // 1 es la mayor; cuenta solo cuando escasea el agua
+	Quota       int           `yaml:"quota" json:"quota"`       // Unidades por quota_period; 0 sin cuota
+	QuotaPeriod time.Duration `yaml:"quota_period" json:"-"`    // Tiempo simulado
+	Rate        int           `yaml:"rate" json:"rate"`         // Unidades por segundo simulado; 0 sin límite
+}
+
+func builtinConsumerDefaults() ConsumerConfig {
+	return ConsumerConfig{Priority: DefaultPriority, QuotaPeriod: DefaultQuotaPeriod}
+}
+
+// withDefaults completa los campos vacíos con los de defaults
+func (c ConsumerConfig) withDefaults(defaults ConsumerConfig) ConsumerConfig {
+	if c.Priority == 0 {
+		c.Priority = defaults.Priority
+	}
+	if c.Quota == 0 {
+		c.Quota = defaults.Quota
+	}
+	if c.QuotaPeriod == 0 {
+		c.QuotaPeriod = defaults.QuotaPeriod
+	}
+	if c.Rate == 0 {
+		c.Rate = defaults.Rate
+	}
+	return c
+}
+
+func (c ConsumerConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("el consumidor necesita un nombre")
+	}
+	if c.Priority < 1 {
+		return fmt.Errorf("%s: priority debe ser al menos 1", c.Name)
+	}
+	if c.Quota < 0 || c.Rate < 0 {
+		return fmt.Errorf("%s: quota y rate no pueden ser negativos", c.Name)
+	}
+	if c.QuotaPeriod <= 0 {
+		return fmt.Errorf("%s: quota_period debe ser positivo", c.Name)
+	}
+	return nil
+}
+
+// Consumer lleva la cuota, el límite de ritmo y los flujos abiertos de quien pide agua
+type Consumer struct {
+	ConsumerConfig
+
+	mu          sync.Mutex
+	used        int       // Unidades entregadas o apartadas en el periodo actual
+	periodStart time.Time // Inicio del periodo de la cuota
+	tokens      float64   // Unidades disponibles para el límite de ritmo
+	lastRefill  time.Time
+	streams     int
+	delivered   int // Total entregado desde el arranque
+
+	auto         bool      // Se creó al pedir agua, no viene de la configuración
+	reservations int       // Reservas activas; mientras haya, el consumidor no se olvida
+	lastSeen     time.Time // Última petición o último flujo cerrado
+}
+
+func newConsumer(config ConsumerConfig) *Consumer {
+	now := clock.Now()
+	return &Consumer{ConsumerConfig: config, periodStart: now, tokens: float64(config.burst()), lastRefill: now, lastSeen: now}
+}
+
+// burst es lo más que puede acumular el límite de ritmo: un segundo de agua o un
+// bloque, lo que sea mayor
+func (c ConsumerConfig) burst() int {
+	return max(c.Rate, BLOCK_SIZE)
+}
+
+// rollPeriodLocked empieza un periodo nuevo de la cuota si el actual ya terminó;
+// requiere c.mu tomado
+func (c *Consumer) rollPeriodLocked(now time.Time) {
+	if elapsed := now.Sub(c.periodStart); elapsed >= c.QuotaPeriod {
+		c.periodStart = c.periodStart.Add(elapsed / c.QuotaPeriod * c.QuotaPeriod)
+		c.used = 0
+	}
+}
+
+// remaining devuelve cuánto le queda de cuota; -1 si no tiene cuota
+func (c *Consumer) remaining() int {
+	if c.Quota == 0 {
+		return -1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rollPeriodLocked(clock.Now())
+	return max(c.Quota-c.used, 0)
+}
+
+// reserveQuota aparta hasta amount unidades de la cuota y devuelve cuántas
+func (c *Consumer) reserveQuota(amount int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Quota == 0 {
+		return amount
+	}
+	c.rollPeriodLocked(clock.Now())
+	granted := min(amount, c.Quota-c.used)
+	if granted <= 0 {
+		return 0
+	}
+	c.used += granted
+	return granted
+}
+
+// settle registra lo que de verdad se entregó de lo apartado y devuelve el resto a la cuota
+func (c *Consumer) settle(reserved int, delivered int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.delivered += delivered
+	if c.Quota > 0 {
+		c.used = max(c.used-(reserved-delivered), 0)
+	}
+}
+
+// waitRate espera, en tiempo simulado, a que el límite de ritmo permita sacar
+// amount unidades; devuelve false si ctx se cancela antes
+func (c *Consumer) waitRate(ctx context.Context, amount int) bool {
+	if c.Rate == 0 {
+		return true
+	}
+	for {
+		c.mu.Lock()
+		now := clock.Now()
+		c.tokens = min(float64(c.burst()), c.tokens+now.Sub(c.lastRefill).Seconds()*float64(c.Rate))
+		c.lastRefill = now
+		if c.tokens >= float64(amount) {
+			c.tokens -= float64(amount)
+			c.mu.Unlock()
+			return true
+		}
+		wait := time.Duration((float64(amount) - c.tokens) / float64(c.Rate) * float64(time.Second))
+		c.mu.Unlock()
+
+		if !sleepContext(ctx, wait) {
+			return false
+		}
+	}
+}
+
+// sleepContext espera la duración simulada d; devuelve false si ctx se cancela antes
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := clock.NewTimer(d)
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	}
+}
+
+// ConsumerStatus es la vista de un consumidor en /consumers
+type ConsumerStatus struct {
+	ConsumerConfig
+	QuotaSeconds float64    `json:"quota_period_seconds"`
+	Used         int        `json:"used"`
+	Remaining    *int       `json:"remaining,omitempty"` // Sin cuota no aparece
+	ResetsAt     *time.Time `json:"resets_at,omitempty"`
+	Streams      int        `json:"active_streams"`
+	Delivered    int        `json:"delivered"`
+	Auto         bool       `json:"auto,omitempty"` // Creado al pedir agua; se olvida tras estar inactivo
+}
+
+func (c *Consumer) status() ConsumerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rollPeriodLocked(clock.Now())
+	status := ConsumerStatus{
+		ConsumerConfig: c.ConsumerConfig,
+		QuotaSeconds:   c.QuotaPeriod.Seconds(),
+		Used:           c.used,
+		Streams:        c.streams,
+		Delivered:      c.delivered,
+		Auto:           c.auto,
+	}
+	if c.Quota > 0 {
+		remaining := max(c.Quota-c.used, 0)
+		resetsAt := c.periodStart.Add(c.QuotaPeriod)
+		status.Remaining = &remaining
+		status.ResetsAt = &resetsAt
+	}
+	return status
+}
+
+// Consumers registra a quien pide agua. Los que no están en la configuración se
+// crean con consumer_defaults la primera vez que piden, hasta max_auto_consumers;
+// se olvidan tras auto_consumer_ttl sin actividad, una vez vencido el periodo de
+// su cuota, y, si ya no caben, cuentan como anonymous.
+type Consumers struct {
+	mu            sync.Mutex
+	defaults      ConsumerConfig
+	consumers     map[string]*Consumer
+	scarcityLevel int
+	maxAuto       int
+	autoTTL       time.Duration
+}
+
+func NewConsumers(config BankConfig, bank *Bank) (*Consumers, error) {
+	defaults := config.ConsumerDefaults.withDefaults(builtinConsumerDefaults())
+	defaults.Name = "consumer_defaults"
+	if err := defaults.validate(); err != nil {
+		return nil, err
+	}
+	registry := &Consumers{
+		defaults:      defaults,
+		consumers:     map[string]*Consumer{},
+		scarcityLevel: config.ScarcityLevel,
+		maxAuto:       config.MaxAutoConsumers,
+		autoTTL:       config.AutoConsumerTTL,
+	}
+	if registry.maxAuto == 0 {
+		registry.maxAuto = DefaultMaxAutoConsumers
+	}
+	if registry.autoTTL == 0 {
+		registry.autoTTL = DefaultAutoConsumerTTL
+	}
+	if registry.maxAuto < 0 || registry.autoTTL < 0 {
+		return nil, fmt.Errorf("max_auto_consumers y auto_consumer_ttl no pueden ser negativos")
+	}
+	if registry.scarcityLevel == 0 {
+		_, total := bank.Totals()
+		registry.scarcityLevel = int(float64(total) * scarcityFraction)
+	}
+	if registry.scarcityLevel < 0 {
+		return nil, fmt.Errorf("scarcity_level no puede ser negativo")
+	}
+
+	for _, consumerConfig := range config.Consumers {
+		consumerConfig = consumerConfig.withDefaults(defaults)
+		if err := consumerConfig.validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := registry.consumers[consumerConfig.Name]; exists {
+			return nil, fmt.Errorf("el consumidor %s está repetido", consumerConfig.Name)
+		}
+		registry.consumers[consumerConfig.Name] = newConsumer(consumerConfig)
+	}
+	return registry, nil
+}
+
+// Get devuelve el consumidor con ese nombre y lo crea si no existía. Si ya no
+// caben más consumidores no configurados devuelve anonymous.
+func (r *Consumers) Get(name string) *Consumer {
+	consumer, _ := r.resolve(name)
+	return consumer
+}
+
+// Named es como Get, pero ok es false si el consumidor tuvo que contar como
+// anonymous. Sirve para lo que queda a nombre del consumidor, como las reservas.
+func (r *Consumers) Named(name string) (consumer *Consumer, ok bool) {
+	consumer, fallback := r.resolve(name)
+	return consumer, !fallback
+}
+
+// resolve busca o crea el consumidor; fallback indica que se usó anonymous en su lugar
+func (r *Consumers) resolve(name string) (consumer *Consumer, fallback bool) {
+	if name == "" {
+		name = AnonymousConsumer
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	consumer, ok := r.consumers[name]
+	if !ok {
+		now := clock.Now()
+		if r.autoCountLocked() >= r.maxAuto {
+			r.pruneLocked(now)
+		}
+		if name != AnonymousConsumer && r.autoCountLocked() >= r.maxAuto {
+			fmt.Printf("Hay %d consumidores no configurados; %s cuenta como %s.\n", r.maxAuto, name, AnonymousConsumer)
+			return r.getLocked(AnonymousConsumer), true
+		}
+		return r.getLocked(name), false
+	}
+	consumer.touch()
+	return consumer, false
+}
+
+// getLocked devuelve el consumidor y lo crea con consumer_defaults si no existía;
+// requiere r.mu tomado
+func (r *Consumers) getLocked(name string) *Consumer {
+	consumer, ok := r.consumers[name]
+	if !ok {
+		config := r.defaults
+		config.Name = name
+		consumer = newConsumer(config)
+		consumer.auto = true
+		r.consumers[name] = consumer
+	}
+	consumer.touch()
+	return consumer
+}
+
+// autoCountLocked cuenta los consumidores no configurados; requiere r.mu tomado
+func (r *Consumers) autoCountLocked() int {
+	count := 0
+	for _, consumer := range r.consumers {
+		if consumer.auto {
+			count++
+		}
+	}
+	return count
+}
+
+// pruneLocked olvida los consumidores no configurados que pueden olvidarse sin
+// perder su cuota; requiere r.mu tomado
+func (r *Consumers) pruneLocked(now time.Time) {
+	for name, consumer := range r.consumers {
+		if consumer.auto && consumer.forgettable(now, r.autoTTL) {
+			delete(r.consumers, name)
+		}
+	}
+}
+
+// touch registra actividad del consumidor
+func (c *Consumer) touch() {
+	c.mu.Lock()
+	c.lastSeen = clock.Now()
+	c.mu.Unlock()
+}
+
+// forgettable indica si el consumidor lleva ttl sin actividad, sin flujos abiertos
+// ni reservas activas, y sin cuota gastada en el periodo actual. Olvidarlo antes
+// de que venza el periodo le devolvería la cuota al volver a pedir agua.
+func (c *Consumer) forgettable(now time.Time, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.streams > 0 || c.reservations > 0 || now.Sub(c.lastSeen) < ttl {
+		return false
+	}
+	if c.Quota == 0 {
+		return true
+	}
+	c.rollPeriodLocked(now)
+	return c.used == 0
+}
+
+// Lookup devuelve el consumidor solo si ya existe
+func (r *Consumers) Lookup(name string) (*Consumer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	consumer, ok := r.consumers[name]
+	return consumer, ok
+}
+
+// Status devuelve el estado de todos los consumidores ordenados por nombre
+func (r *Consumers) Status() []ConsumerStatus {
+	r.mu.Lock()
+	consumers := make([]*Consumer, 0, len(r.consumers))
+	for _, consumer := range r.consumers {
+		consumers = append(consumers, consumer)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	statuses := make([]ConsumerStatus, len(consumers))
+	for i, consumer := range consumers {
+		statuses[i] = consumer.status()
+	}
+	return statuses
+}
+
+// openStream y closeStream llevan la cuenta de los flujos abiertos del consumidor
+func (c *Consumer) openStream() {
+	c.mu.Lock()
+	c.streams++
+	c.mu.Unlock()
+}
+
+func (c *Consumer) closeStream() {
+	c.mu.Lock()
+	c.streams--
+	c.lastSeen = clock.Now()
+	c.mu.Unlock()
+}
+
+// holdReservation y releaseReservation llevan la cuenta de las reservas activas del consumidor
+func (c *Consumer) holdReservation() {
+	c.mu.Lock()
+	c.reservations++
+	c.mu.Unlock()
+}
+
+func (c *Consumer) releaseReservation() {
+	c.mu.Lock()
+	c.reservations--
+	c.lastSeen = clock.Now()
+	c.mu.Unlock()
+}
+
+// outranked indica si hay un flujo abierto de un consumidor con más prioridad
+func (r *Consumers) outranked(consumer *Consumer) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.consumers {
+		if other == consumer || other.Priority >= consumer.Priority {
+			continue
+		}
+		other.mu.Lock()
+		active := other.streams > 0
+		other.mu.Unlock()
+		if active {
+			return true
+		}
+	}
+	return false
+}
+
+// waitTurn espera mientras el agua escasea y un consumidor con más prioridad
+// tiene un flujo abierto; devuelve false si ctx se cancela antes
+func (r *Consumers) waitTurn(ctx context.Context, consumer *Consumer, bank *Bank) bool {
+	announced := false
+	for {
+		level, _ := bank.Totals()
+		if level >= r.scarcityLevel || !r.outranked(consumer) {
+			return true
+		}
+		if !announced {
+			fmt.Printf("Agua escasa (%d): %s espera a consumidores con más prioridad.\n", level, consumer.Name)
+			announced = true
+		}
+		if !sleepContext(ctx, ScarcityCheckInterval) {
+			return false
+		}
+	}
+}
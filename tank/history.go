@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+const (
+	HistoryStoreEnv       = "TANK_HISTORY_STORE" // Ruta del archivo del historial; vacío o "memory" lo guarda solo en memoria
+	HistorySizeEnv        = "TANK_HISTORY_SIZE"  // Cuántas muestras conserva el historial
+	HistorySampleInterval = 10 * time.Second     // Tiempo simulado entre muestras
+	DefaultHistorySize    = 8640                 // Un día de muestras cada 10 segundos
+	MaxHistoryPoints      = 10000                // Máximo de intervalos en una respuesta de /history
+)
+
+// TankFlow acumula el agua que entró y salió de un tanque desde el arranque. Las
+// transferencias entre tanques del banco se cuentan aparte para poder sumarlas sin
+// que parezcan consumo.
+type TankFlow struct {
+	Inflow      int `json:"inflow"`  // Agua recibida de SAPAM
+	Outflow     int `json:"outflow"` // Agua suministrada a las lavadoras
+	TransferIn  int `json:"transfer_in"`
+	TransferOut int `json:"transfer_out"`
+}
+
+func (f TankFlow) minus(other TankFlow) TankFlow {
+	return TankFlow{
+		Inflow:      f.Inflow - other.Inflow,
+		Outflow:     f.Outflow - other.Outflow,
+		TransferIn:  f.TransferIn - other.TransferIn,
+		TransferOut: f.TransferOut - other.TransferOut,
+	}
+}
+
+func (f TankFlow) plus(other TankFlow) TankFlow {
+	return TankFlow{
+		Inflow:      f.Inflow + other.Inflow,
+		Outflow:     f.Outflow + other.Outflow,
+		TransferIn:  f.TransferIn + other.TransferIn,
+		TransferOut: f.TransferOut + other.TransferOut,
+	}
+}
+
+// sample devuelve el nivel y el flujo acumulado del tanque
+func (t *Tank) sample() (int16, TankFlow) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.capacity, t.flow
+}
+
+// TankSample es el nivel de un tanque y lo que entró y salió desde la muestra anterior
+type TankSample struct {
+	Tank  string `json:"tank"`
+	Level int    `json:"level"`
+	TankFlow
+}
+
+// Snapshot es una muestra de todos los tanques tomada en el mismo instante simulado
+type Snapshot struct {
+	Time  time.Time    `json:"time"`
+	Tanks []TankSample `json:"tanks"`
+}
+
+// History es un búfer circular de muestras. Si tiene archivo, anexa cada muestra
+// como una línea JSON y al abrir recupera las más recientes.
+type History struct {
+	mu        sync.Mutex
+	snapshots []Snapshot
+	next      int // Posición donde se escribe la siguiente muestra
+	full      bool
+	file      *os.File
+}
+
+// OpenHistory crea el historial según TANK_HISTORY_STORE y TANK_HISTORY_SIZE
+func OpenHistory() (*History, error) {
+	size := DefaultHistorySize
+	if value := os.Getenv(HistorySizeEnv); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("%s debe ser un número entero positivo, no %q", HistorySizeEnv, value)
+		}
+		size = parsed
+	}
+
+	h := &History{snapshots: make([]Snapshot, size)}
+	path := os.Getenv(HistoryStoreEnv)
+	if path == "" || path == "memory" {
+		return h, nil
+	}
+
+	if err := h.replay(path); err != nil {
+		return nil, err
+	}
+	if err := compactHistory(path, h.all()); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	h.file = file
+	fmt.Printf("Historial cargado de %s: %d muestras\n", path, len(h.all()))
+	return h, nil
+}
+
+// replay carga las muestras del archivo; las más viejas quedan fuera si no caben.
+// Una línea corrupta (p. ej. por un corte durante la escritura) se descarta.
+func (h *History) replay(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		var snapshot Snapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			fmt.Printf("Se descartó la línea %d de %s: %v\n", lineNumber, path, err)
+			continue
+		}
+		h.appendLocked(snapshot)
+	}
+	return scanner.Err()
+}
+
+// compactHistory reescribe el archivo solo con las muestras que caben en el búfer
+func compactHistory(path string, snapshots []Snapshot) error {
+	tmpPath := path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, snapshot := range snapshots {
+		if err := encoder.Encode(snapshot); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (h *History) appendLocked(snapshot Snapshot) {
+	h.snapshots[h.next] = snapshot
+	h.next = (h.next + 1) % len(h.snapshots)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Record guarda una muestra y, si hay archivo, la anexa
+func (h *History) Record(snapshot Snapshot) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.appendLocked(snapshot)
+	if h.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = h.file.Write(append(line, '\n'))
+	return err
+}
+
+// all devuelve las muestras de la más vieja a la más reciente
+func (h *History) all() []Snapshot {
+	if !h.full {
+		return append([]Snapshot(nil), h.snapshots[:h.next]...)
+	}
+	return append(append([]Snapshot(nil), h.snapshots[h.next:]...), h.snapshots[:h.next]...)
+}
+
+// Between devuelve las muestras tomadas en [from, to) ordenadas por hora. Se
+// ordenan porque tras un reinicio el reloj simulado puede volver a una hora que ya
+// estaba en el historial.
+func (h *History) Between(from time.Time, to time.Time) []Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var found []Snapshot
+	for _, snapshot := range h.all() {
+		if !snapshot.Time.Before(from) && snapshot.Time.Before(to) {
+			found = append(found, snapshot)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Time.Before(found[j].Time)
+	})
+	return found
+}
+
+// Run toma una muestra de cada tanque cada HistorySampleInterval
+func (h *History) Run(bank *Bank) {
+	previous := map[string]TankFlow{}
+	for {
+		snapshot := Snapshot{Time: clock.Now()}
+		for _, tank := range bank.All() {
+			level, flow := tank.sample()
+			snapshot.Tanks = append(snapshot.Tanks, TankSample{
+				Tank:     tank.name,
+				Level:    int(level),
+				TankFlow: flow.minus(previous[tank.name]),
+			})
+			previous[tank.name] = flow
+		}
+		if err := h.Record(snapshot); err != nil {
+			fmt.Printf("No se pudo guardar la muestra del historial: %v\n", err)
+		}
+		clock.Sleep(HistorySampleInterval)
+	}
+}
+
+// HistoryPoint resume las muestras de un intervalo de /history. El nivel es el de
+// las muestras del intervalo; los flujos son lo que entró y salió en él.
+type HistoryPoint struct {
+	Start     time.Time `json:"start"`
+	Samples   int       `json:"samples"`
+	LevelMin  int       `json:"level_min"`
+	LevelMax  int       `json:"level_max"`
+	LevelAvg  float64   `json:"level_avg"`
+	LevelLast int       `json:"level_last"`
+	TankFlow
+}
+
+// Aggregate agrupa las muestras en intervalos de resolution alineados a from.
+// Con tank vacío suma todos los tanques del banco en cada muestra. Los intervalos
+// sin muestras no aparecen.
+func Aggregate(snapshots []Snapshot, tank string, from time.Time, resolution time.Duration) []HistoryPoint {
+	var points []HistoryPoint
+	var levelSum int
+	for _, snapshot := range snapshots {
+		level, flow, ok := snapshotTotals(snapshot, tank)
+		if !ok {
+			continue
+		}
+
+		start := from.Add(snapshot.Time.Sub(from) / resolution * resolution)
+		if len(points) == 0 || !points[len(points)-1].Start.Equal(start) {
+			points = append(points, HistoryPoint{Start: start, LevelMin: level, LevelMax: level})
+			levelSum = 0
+		}
+		point := &points[len(points)-1]
+		point.Samples++
+		point.LevelMin = min(point.LevelMin, level)
+		point.LevelMax = max(point.LevelMax, level)
+		point.LevelLast = level
+		levelSum += level
+		point.LevelAvg = float64(levelSum) / float64(point.Samples)
+		point.TankFlow = point.TankFlow.plus(flow)
+	}
+	return points
+}
+
+// snapshotTotals devuelve el nivel y el flujo del tanque en la muestra, o la suma
+// de todos si tank está vacío; ok es false si el tanque no aparece en la muestra
+func snapshotTotals(snapshot Snapshot, tank string) (level int, flow TankFlow, ok bool) {
+	for _, sample := range snapshot.Tanks {
+		if tank != "" && sample.Tank != tank {
+			continue
+		}
+		level += sample.Level
+		flow = flow.plus(sample.TankFlow)
+		ok = true
+	}
+	return level, flow, ok
+}
@@ -1,20 +1,58 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+	"github.com/M1keTrike/LaundryAPI_Go/internal/stream"
 	"github.com/gin-gonic/gin"
 )
 
 type Tank struct {
-	capacity int16
-	mutex    sync.Mutex
+	name          string
+	maxCapacity   int16
+	lowWatermark  int16 // Nivel por debajo del cual empieza la recarga
+	highWatermark int16 // Nivel en el que termina la recarga
+	windows       []RefillWindow
+	backoffMin    time.Duration
+	backoffMax    time.Duration
+	priority      int
+	source        string // sapam, none o el tanque del que se bombea el agua
+	capacity      int16  // Agua que contiene el tanque
+	flow          TankFlow
+	mutex         sync.Mutex
+	refill        refillMonitor
+}
+
+// newTank crea un tanque lleno; config ya debe estar validada
+func newTank(config TankConfig) *Tank {
+	tank := &Tank{
+		name:          config.Name,
+		maxCapacity:   config.MaxCapacity,
+		lowWatermark:  config.LowWatermark,
+		highWatermark: config.HighWatermark,
+		backoffMin:    config.BackoffMin,
+		backoffMax:    config.BackoffMax,
+		priority:      config.Priority,
+		source:        config.Source,
+		capacity:      config.MaxCapacity,
+	}
+	for _, value := range config.RefillWindows {
+		window, _ := parseRefillWindow(value)
+		tank.windows = append(tank.windows, window)
+	}
+	return tank
 }
 
 const (
@@ -22,18 +60,37 @@ const (
 	REFILL_THRESHOLD int16 = 1490
 	WATER_SERVER_URL       = "http://localhost:4005/water?quantity=" // URL base del servidor de agua
 	REFILL_QUANTITY        = 30
+	BLOCK_SIZE             = 10 // Unidades de agua por bloque entregado
+
+	ShutdownTimeout = 5 * time.Second // Espera a que terminen los suministros abiertos al detener el servicio
 )
 
+// errTankFull detiene la lectura de un flujo de SAPAM cuando el tanque se llena
+var errTankFull = errors.New("el tanque ha alcanzado su capacidad máxima")
+
+// fillFrom pide quantity bloques a SAPAM y los añade al tanque hasta que el flujo
+// termina o el tanque se llena
+func (t *Tank) fillFrom(ctx context.Context, quantity int) (stream.Summary, error) {
+	url := fmt.Sprintf("%s%d", WATER_SERVER_URL, quantity)
+	return stream.Fetch(ctx, http.MethodGet, url, stream.Water, func(block stream.Block) error {
+		if !t.AddWater(int16(block.Amount)) {
+			return errTankFull
+		}
+		return nil
+	})
+}
+
 // Método para añadir agua al tanque
 func (t *Tank) AddWater(amount int16) bool {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	if t.capacity+amount > MAX_CAPACITY {
+	if t.capacity+amount > t.maxCapacity {
 		return false // No se puede añadir más agua porque supera la capacidad
 	}
 	t.capacity += amount
-	fmt.Printf("Se añadieron %d unidades de agua al tanque. Capacidad actual: %d\n", amount, t.capacity)
+	t.flow.Inflow += int(amount)
+	fmt.Printf("Se añadieron %d unidades de agua al tanque %s. Capacidad actual: %d\n", amount, t.name, t.capacity)
 	return true
 }
 
@@ -44,6 +101,13 @@ func (t *Tank) GetCapacity() int16 {
 	return t.capacity
 }
 
+// freeRoom devuelve cuánta agua cabe todavía en el tanque
+func (t *Tank) freeRoom() int16 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.maxCapacity - t.capacity
+}
+
 // Método para usar agua del tanque
 func (t *Tank) UseWater(amount int16) error {
 	t.mutex.Lock()
@@ -53,181 +117,470 @@ func (t *Tank) UseWater(amount int16) error {
 		return fmt.Errorf("no hay suficiente agua en el tanque")
 	}
 	t.capacity -= amount
-	fmt.Printf("Se suministraron %d unidades de agua. Capacidad restante: %d\n", amount, t.capacity)
+	t.flow.Outflow += int(amount)
+	fmt.Printf("Se suministraron %d unidades de agua del tanque %s. Capacidad restante: %d\n", amount, t.name, t.capacity)
 	return nil
 }
 
-// Función para gestionar el proceso de recarga
-func (t *Tank) MonitorAndRefill() {
-	for {
-		t.mutex.Lock()
-		if t.capacity < REFILL_THRESHOLD {
-			fmt.Println("El nivel del tanque es bajo. Iniciando recarga...")
-			t.mutex.Unlock()
-
-			// Solicitar agua al servidor de SAPAM
-			url := fmt.Sprintf("%s%d", WATER_SERVER_URL, REFILL_QUANTITY)
-			resp, err := http.Get(url)
-			if err != nil {
-				fmt.Printf("Error al solicitar recarga: %v\n", err)
-				continue
-			}
-			defer resp.Body.Close()
-
-			reader := bufio.NewReader(resp.Body)
-			for {
-				line, err := reader.ReadBytes('\n')
-				if err != nil {
-					if err.Error() == "EOF" {
-						break
-					}
-					fmt.Printf("Error leyendo respuesta: %v\n", err)
-					break
-				}
-
-				var payload map[string]int
-				if err := json.Unmarshal(line, &payload); err != nil {
-					fmt.Printf("Error procesando bloque: %v\n", err)
-					break
-				}
-
-				amount := int16(payload["water"])
-				if !t.AddWater(amount) {
-					fmt.Println("El tanque ha alcanzado su capacidad máxima durante la recarga.")
-					break
-				}
-			}
-		} else {
-			t.mutex.Unlock()
+// Función para entregar agua en bloques de BLOCK_SIZE unidades; la política del
+// banco decide de qué tanque sale cada bloque. Cada bloque respeta la cuota y el
+// ritmo del consumidor y, si el agua escasea, espera a los de mayor prioridad. El
+// resumen final indica cuánto se entregó de lo pedido y por qué terminó.
+func deliverWaterChunked(c *gin.Context, bank *Bank, consumers *Consumers, consumer *Consumer, quantity int) {
+	consumer.openStream()
+	defer consumer.closeStream()
+
+	summary := stream.Serve(c.Request.Context(), c.Writer, stream.Water, quantity*BLOCK_SIZE, quantity, 1*time.Second, func(ctx context.Context, i int) (int, stream.Reason) {
+		if !consumers.waitTurn(ctx, consumer, bank) {
+			return 0, stream.ReasonCancelled
+		}
+		reserved := consumer.reserveQuota(BLOCK_SIZE)
+		if reserved == 0 {
+			fmt.Printf("%s agotó su cuota de agua.\n", consumer.Name)
+			return 0, stream.ReasonQuota
+		}
+		if !consumer.waitRate(ctx, reserved) {
+			consumer.settle(reserved, 0)
+			return 0, stream.ReasonCancelled
 		}
 
-		time.Sleep(1 * time.Second) // Revisar el nivel del tanque cada segundo
-	}
+		tank, amount, err := bank.Draw(int16(reserved))
+		consumer.settle(reserved, int(amount))
+		if err != nil {
+			fmt.Println("El banco no tiene suficiente agua para suministrar más bloques.")
+			return 0, stream.ReasonExhausted
+		}
+		fmt.Printf("Suministrando %d unidades de agua a %s desde %s.\n", amount, consumer.Name, tank.name)
+		return int(amount), ""
+	})
+	fmt.Printf("Suministro de agua a %s terminado (%s): %d de %d unidades.\n", consumer.Name, summary.Reason, summary.Delivered, summary.Requested)
 }
 
-// Función para entregar agua en formato chunked
-func deliverWaterChunked(c *gin.Context, tank *Tank, quantity int) {
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.Header().Set("Transfer-Encoding", "chunked")
-	c.Writer.WriteHeader(http.StatusOK)
-
-	waterChan := make(chan string)
-
-	go func() {
-		for i := 0; i < quantity; i++ {
-			tank.mutex.Lock()
-			if tank.capacity < 10 {
-				tank.mutex.Unlock()
-				fmt.Println("El tanque no tiene suficiente agua para suministrar más bloques.")
-				break
-			}
-			tank.capacity -= 10
-			fmt.Printf("Suministrando 10 unidades de agua. Capacidad restante: %d\n", tank.capacity)
-			tank.mutex.Unlock()
-
-			// Crear el bloque de agua
-			block := map[string]int{"water": 10}
-			blockJSON, _ := json.Marshal(block)
-			waterChan <- string(blockJSON) + "\n"
-
-			// Simular 1 segundo por bloque
-			time.Sleep(1 * time.Second)
+// deliverReservedWater entrega en bloques hasta units unidades de la reserva. El
+// agua ya está apartada, así que no espera a los consumidores de mayor prioridad;
+// solo respeta el ritmo del consumidor.
+func deliverReservedWater(c *gin.Context, reservations *Reservations, consumer *Consumer, reservation Reservation, units int) {
+	consumer.openStream()
+	defer consumer.closeStream()
+	defer reservations.Close(reservation.ID)
+
+	blocks := (units + BLOCK_SIZE - 1) / BLOCK_SIZE
+	summary := stream.Serve(c.Request.Context(), c.Writer, stream.Water, units, blocks, 1*time.Second, func(ctx context.Context, i int) (int, stream.Reason) {
+		amount := min(BLOCK_SIZE, units-i*BLOCK_SIZE)
+		if !consumer.waitRate(ctx, amount) {
+			return 0, stream.ReasonCancelled
+		}
+		tank, drawn, err := reservations.Draw(reservation.ID, int16(amount))
+		if errors.Is(err, errReservationClosed) {
+			fmt.Printf("La reserva %s se cerró durante el suministro.\n", reservation.ID)
+			return 0, stream.ReasonCancelled
 		}
-		close(waterChan)
-	}()
-
-	// Enviar los bloques chunked
-	for block := range waterChan {
-		_, err := c.Writer.Write([]byte(block))
 		if err != nil {
-			fmt.Println("Error enviando bloque de agua:", err)
-			break
+			fmt.Printf("El banco no pudo entregar el agua de la reserva %s: %v\n", reservation.ID, err)
+			return 0, stream.ReasonExhausted
 		}
-		c.Writer.Flush()
+		fmt.Printf("Suministrando %d unidades de agua reservada a %s desde %s.\n", drawn, consumer.Name, tank.name)
+		return int(drawn), ""
+	})
+	fmt.Printf("Suministro de la reserva %s a %s terminado (%s): %d de %d unidades.\n", reservation.ID, consumer.Name, summary.Reason, summary.Delivered, summary.Requested)
+}
+
+// fillTank llena el tanque con la cantidad de bloques de SAPAM que indica ?quantity=
+func fillTank(c *gin.Context, tank *Tank) {
+	quantityStr := c.Query("quantity")
+	if quantityStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'quantity' es requerido"})
+		return
+	}
+	quantity, err := strconv.Atoi(quantityStr)
+	if err != nil || quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'quantity' debe ser un número entero positivo"})
+		return
+	}
+
+	// Solicitar agua al servidor de agua
+	summary, err := tank.fillFrom(c.Request.Context(), quantity)
+	if errors.Is(err, errTankFull) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("El tanque %s ha alcanzado su capacidad máxima", tank.name), "delivered": summary.Delivered})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("No se pudo obtener agua: %v", err)})
+		return
 	}
-	fmt.Println("Suministro de agua completado o interrumpido.")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Tanque llenado exitosamente",
+		"tank":             tank.name,
+		"current_capacity": tank.GetCapacity(),
+		"summary":          summary,
+	})
 }
 
 func main() {
-	tank := &Tank{capacity: MAX_CAPACITY} // Inicializar el tanque con capacidad máxima
-	go tank.MonitorAndRefill()            // Iniciar monitoreo del nivel del tanque
+	if err := clock.Setup(); err != nil {
+		log.Fatalf("Configuración del reloj inválida: %v", err)
+	}
+
+	config, err := LoadBankConfig()
+	if err != nil {
+		log.Fatalf("No se pudo leer la configuración del banco de tanques: %v", err)
+	}
+	bank, err = NewBank(config)
+	if err != nil {
+		log.Fatalf("Configuración del banco de tanques inválida: %v", err)
+	}
+	// Al detener el servicio se cortan los monitores y los flujos que estén pidiendo a SAPAM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, tank := range bank.All() {
+		go tank.MonitorAndRefill(ctx, bank) // Iniciar monitoreo del nivel de cada tanque
+	}
+
+	consumers, err := NewConsumers(config, bank)
+	if err != nil {
+		log.Fatalf("Configuración de consumidores inválida: %v", err)
+	}
+
+	reservations := NewReservations(bank)
+
+	history, err := OpenHistory()
+	if err != nil {
+		log.Fatalf("No se pudo abrir el historial de los tanques: %v", err)
+	}
+	go history.Run(bank)
 
 	r := gin.Default()
+	clock.RegisterRoutes(r)
 
 	r.GET("/status", func(c *gin.Context) {
-		// Devuelve el estado actual del tanque
+		// Devuelve el estado del banco: la suma de los tanques y el detalle de cada uno
+		level, max := bank.Totals()
 		c.JSON(http.StatusOK, gin.H{
-			"capacity":    tank.GetCapacity(),
-			"max_capacity": MAX_CAPACITY,
+			"capacity":     level,
+			"max_capacity": max,
+			"reserved":     bank.Reserved(),
+			"policy":       bank.Policy(),
+			"tanks":        bank.Status(),
 		})
 	})
 
-	r.POST("/fill", func(c *gin.Context) {
-		quantityStr := c.Query("quantity")
-		if quantityStr == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'quantity' es requerido"})
-			return
-		}
-		quantity, err := strconv.Atoi(quantityStr)
-		if err != nil || quantity <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'quantity' debe ser un número entero positivo"})
+	r.GET("/tanks", func(c *gin.Context) {
+		c.JSON(http.StatusOK, bank.Status())
+	})
+
+	r.GET("/tanks/:name/status", func(c *gin.Context) {
+		tank := bank.Get(c.Param("name"))
+		if tank == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tanque no encontrado"})
 			return
 		}
+		c.JSON(http.StatusOK, tank.status())
+	})
 
-		// Solicitar agua al servidor de agua
-		resp, err := http.Get(WATER_SERVER_URL + strconv.Itoa(quantity))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("No se pudo obtener agua: %v", err)})
+	// Estado de la recarga: si está recargando, esperando su horario o reintentando, y el último error
+	r.GET("/tanks/:name/refill", func(c *gin.Context) {
+		tank := bank.Get(c.Param("name"))
+		if tank == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tanque no encontrado"})
 			return
 		}
-		defer resp.Body.Close()
+		c.JSON(http.StatusOK, tank.refillStatus())
+	})
 
-		reader := bufio.NewReader(resp.Body)
-		for {
-			line, err := reader.ReadBytes('\n')
-			if err != nil {
-				if err.Error() == "EOF" {
-					break
-				}
-				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error leyendo respuesta: %v", err)})
+	// Serie de nivel y flujos por intervalo: /history?from=...&to=...&resolution=1h&tank=cistern
+	// Sin tank suma todo el banco; por defecto devuelve las últimas 24 horas por hora.
+	r.GET("/history", func(c *gin.Context) {
+		var err error
+		to := clock.Now()
+		if value := c.Query("to"); value != "" {
+			if to, err = time.Parse(time.RFC3339, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'to' debe ser una hora RFC 3339"})
 				return
 			}
-
-			var payload map[string]int
-			if err := json.Unmarshal(line, &payload); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error procesando bloque: %v", err)})
+		}
+		from := to.Add(-24 * time.Hour)
+		if value := c.Query("from"); value != "" {
+			if from, err = time.Parse(time.RFC3339, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'from' debe ser una hora RFC 3339"})
 				return
 			}
+		}
+		if !from.Before(to) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "'from' debe ser anterior a 'to'"})
+			return
+		}
 
-			amount := int16(payload["water"])
-			if !tank.AddWater(amount) {
-				c.JSON(http.StatusConflict, gin.H{"error": "El tanque ha alcanzado su capacidad máxima"})
+		resolution := time.Hour
+		if value := c.Query("resolution"); value != "" {
+			resolution, err = time.ParseDuration(value)
+			if err != nil || resolution < HistorySampleInterval {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("El parámetro 'resolution' debe ser una duración de al menos %v", HistorySampleInterval)})
 				return
 			}
 		}
+		if to.Sub(from)/resolution > MaxHistoryPoints {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("El rango pedido tiene más de %d intervalos; usa una resolución mayor", MaxHistoryPoints)})
+			return
+		}
 
+		tank := c.Query("tank")
+		if tank != "" && bank.Get(tank) == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tanque no encontrado"})
+			return
+		}
+
+		points := Aggregate(history.Between(from, to), tank, from, resolution)
+		if points == nil {
+			points = []HistoryPoint{}
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"message":         "Tanque llenado exitosamente",
-			"current_capacity": tank.GetCapacity(),
+			"tank":       tank,
+			"from":       from,
+			"to":         to,
+			"resolution": resolution.String(),
+			"points":     points,
 		})
 	})
 
+	// Cuota, ritmo y flujos abiertos de quienes piden agua con /supply
+	r.GET("/consumers", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"scarcity_level": consumers.scarcityLevel, "consumers": consumers.Status()})
+	})
+
+	r.GET("/consumers/:name", func(c *gin.Context) {
+		consumer, ok := consumers.Lookup(c.Param("name"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Consumidor no encontrado"})
+			return
+		}
+		c.JSON(http.StatusOK, consumer.status())
+	})
+
+	// Llena el primer tanque alimentado por SAPAM que tenga espacio
+	r.POST("/fill", func(c *gin.Context) {
+		tank := bank.Inlet()
+		if tank == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Ningún tanque se alimenta de SAPAM"})
+			return
+		}
+		fillTank(c, tank)
+	})
+
+	r.POST("/tanks/:name/fill", func(c *gin.Context) {
+		tank := bank.Get(c.Param("name"))
+		if tank == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tanque no encontrado"})
+			return
+		}
+		fillTank(c, tank)
+	})
+
+	// Pasa agua de un tanque a otro: /tanks/transfer?from=cistern&to=rooftop&quantity=200
+	r.POST("/tanks/transfer", func(c *gin.Context) {
+		quantity, err := strconv.Atoi(c.Query("quantity"))
+		if err != nil || quantity <= 0 || quantity > math.MaxInt16 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'quantity' debe ser un número entero positivo"})
+			return
+		}
+
+		from, to := c.Query("from"), c.Query("to")
+		err = bank.Transfer(from, to, int16(quantity))
+		switch {
+		case errors.Is(err, errUnknownTank):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, errSameTank):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, gin.H{
+				"message": "Transferencia completada",
+				"from":    bank.Get(from).status(),
+				"to":      bank.Get(to).status(),
+			})
+		}
+	})
+
+	// Aparta agua para un consumidor: /reservations?quantity=50&ttl=2m con la cabecera
+	// X-Consumer. El agua reservada solo sale con /supply?reservation=ID.
+	r.POST("/reservations", func(c *gin.Context) {
+		quantity, err := strconv.Atoi(c.Query("quantity"))
+		if err != nil || quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'quantity' debe ser un número entero positivo de unidades"})
+			return
+		}
+		ttl := DefaultReservationTTL
+		if value := c.Query("ttl"); value != "" {
+			ttl, err = time.ParseDuration(value)
+			if err != nil || ttl <= 0 || ttl > MaxReservationTTL {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("El parámetro 'ttl' debe ser una duración positiva de hasta %v", MaxReservationTTL)})
+				return
+			}
+		}
+
+		consumer, ok := consumers.Named(c.GetHeader(stream.ConsumerHeader))
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": errReservationNoName.Error()})
+			return
+		}
+		reservation, err := reservations.Create(consumer, quantity, ttl)
+		switch {
+		case errors.Is(err, errReservationQuota):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "consumer": consumer.status()})
+		case err != nil:
+			level, _ := bank.Totals()
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "available": level - bank.Reserved()})
+		default:
+			c.JSON(http.StatusCreated, reservation)
+		}
+	})
+
+	// Lista las reservas activas; con ?all=true también las cerradas
+	r.GET("/reservations", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"reserved": bank.Reserved(), "reservations": reservations.List(c.Query("all") != "true")})
+	})
+
+	r.GET("/reservations/:id", func(c *gin.Context) {
+		reservation, ok := reservations.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": errUnknownReservation.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, reservation)
+	})
+
+	// Cancela la reserva y devuelve lo que quede al suministro normal
+	r.DELETE("/reservations/:id", func(c *gin.Context) {
+		reservation, err := reservations.Cancel(c.Param("id"))
+		switch {
+		case errors.Is(err, errUnknownReservation):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "reservation": reservation})
+		default:
+			c.JSON(http.StatusOK, reservation)
+		}
+	})
+
+	// Pasa la reserva a otro consumidor: /reservations/ID/transfer?to=washer2 con la
+	// cabecera X-Consumer del dueño actual
+	r.POST("/reservations/:id/transfer", func(c *gin.Context) {
+		to := c.Query("to")
+		if to == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'to' es requerido"})
+			return
+		}
+		from := consumers.Get(c.GetHeader(stream.ConsumerHeader))
+		target, ok := consumers.Named(to)
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": errReservationNoName.Error()})
+			return
+		}
+		reservation, err := reservations.Transfer(c.Param("id"), from, target)
+		switch {
+		case errors.Is(err, errUnknownReservation):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, errReservationOwner):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, errReservationQuota):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "reservation": reservation})
+		case err != nil:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "reservation": reservation})
+		default:
+			c.JSON(http.StatusOK, reservation)
+		}
+	})
+
+	// Entrega agua en bloques: /supply?quantity=3 con la cabecera X-Consumer. Con
+	// ?reservation=ID el agua sale de esa reserva y quantity es opcional.
 	r.POST("/supply", func(c *gin.Context) {
 		quantityStr := c.Query("quantity")
-		if quantityStr == "" {
+		reservationID := c.Query("reservation")
+		if quantityStr == "" && reservationID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'quantity' es requerido"})
 			return
 		}
-		quantity, err := strconv.Atoi(quantityStr)
-		if err != nil || quantity <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'quantity' debe ser un número entero positivo"})
+		quantity := 0
+		if quantityStr != "" {
+			var err error
+			quantity, err = strconv.Atoi(quantityStr)
+			if err != nil || quantity <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'quantity' debe ser un número entero positivo"})
+				return
+			}
+		}
+
+		consumer := consumers.Get(c.GetHeader(stream.ConsumerHeader))
+		if reservationID != "" {
+			reservation, err := reservations.Open(reservationID, consumer)
+			switch {
+			case errors.Is(err, errUnknownReservation):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			case errors.Is(err, errReservationOwner):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			case err != nil:
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "reservation": reservation})
+				return
+			}
+
+			// Sin quantity se entrega todo lo que queda de la reserva
+			units := reservation.Remaining
+			if quantity > 0 {
+				units = min(units, quantity*BLOCK_SIZE)
+			}
+			fmt.Printf("Recibida solicitud de suministro de %d unidades de la reserva %s de %s.\n", units, reservation.ID, consumer.Name)
+			deliverReservedWater(c, reservations, consumer, reservation, units)
+			return
+		}
+
+		// La cuota agotada se rechaza antes de abrir el flujo
+		if consumer.remaining() == 0 {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("%s agotó su cuota de agua", consumer.Name), "consumer": consumer.status()})
 			return
 		}
 
-		fmt.Printf("Recibida solicitud de suministro de %d unidades de agua. Capacidad actual: %d\n", quantity, tank.GetCapacity())
-		deliverWaterChunked(c, tank, quantity)
+		level, _ := bank.Totals()
+		fmt.Printf("Recibida solicitud de suministro de %d unidades de agua de %s. Capacidad actual: %d\n", quantity, consumer.Name, level)
+		deliverWaterChunked(c, bank, consumers, consumer, quantity)
+	})
+
+	// Administración del banco en tiempo de ejecución
+	admin := r.Group("/admin/tanks")
+
+	admin.GET("/policy", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"policy": bank.Policy(), "policies": policies})
+	})
+
+	// Cambia la política con la que /supply elige el tanque de cada bloque
+	admin.PUT("/policy", func(c *gin.Context) {
+		var request struct {
+			Policy SupplyPolicy `json:"policy"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cuerpo inválido: %v", err)})
+			return
+		}
+		if err := bank.SetPolicy(request.Policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "policies": policies})
+			return
+		}
+		fmt.Printf("Política de suministro: %s\n", request.Policy)
+		c.JSON(http.StatusOK, gin.H{"policy": bank.Policy(), "policies": policies})
 	})
 
 	// Ejecutar el servidor en el puerto 4006
-	r.Run(":4006")
+	server := &http.Server{Addr: ":4006", Handler: r}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("El servidor del tanque terminó con error: %v", err)
+	}
 }
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+	"github.com/M1keTrike/LaundryAPI_Go/internal/stream"
+)
+
+const (
+	RefillCheckInterval  = 1 * time.Second  // Cada cuánto se revisa el nivel de un tanque
+	DefaultBackoffMin    = 1 * time.Second  // Primera espera tras una recarga fallida
+	DefaultBackoffMax    = 60 * time.Second // Espera máxima entre intentos fallidos
+	minutesPerDay        = 24 * 60
+	refillWindowExample  = "22:00-06:00"
+	refillWindowTimeForm = "15:04"
+)
+
+// RefillState es lo que está haciendo el monitor de recarga de un tanque
+type RefillState string
+
+const (
+	RefillIdle          RefillState = "idle"           // El nivel está sobre la marca baja
+	RefillActive        RefillState = "refilling"      // Recargando hasta la marca alta
+	RefillWaitingWindow RefillState = "waiting_window" // Hace falta agua pero no es horario de recarga
+	RefillBackoff       RefillState = "backoff"        // El último intento falló; espera antes de reintentar
+	RefillDisabled      RefillState = "disabled"       // El tanque no se recarga solo
+)
+
+var errSourceEmpty = errors.New("el tanque de origen no tiene agua")
+
+// RefillWindow es un horario del día, en la hora simulada, en el que se permite
+// recargar. Si el fin es anterior al inicio, la ventana cruza la medianoche.
+type RefillWindow struct {
+	start int // Minutos desde la medianoche
+	end   int
+}
+
+// parseRefillWindow lee una ventana con la forma "22:00-06:00"
+func parseRefillWindow(value string) (RefillWindow, error) {
+	startStr, endStr, _ := strings.Cut(value, "-")
+	start, err := minuteOfDay(startStr)
+	if err != nil {
+		return RefillWindow{}, fmt.Errorf("ventana de recarga %q inválida; se espera la forma %q", value, refillWindowExample)
+	}
+	end, err := minuteOfDay(endStr)
+	if err != nil || start == end {
+		return RefillWindow{}, fmt.Errorf("ventana de recarga %q inválida; se espera la forma %q", value, refillWindowExample)
+	}
+	return RefillWindow{start: start, end: end}, nil
+}
+
+func minuteOfDay(value string) (int, error) {
+	if value == "24:00" {
+		return minutesPerDay, nil
+	}
+	parsed, err := time.Parse(refillWindowTimeForm, value)
+	if err != nil {
+		return 0, err
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// contains indica si la hora t cae dentro de la ventana
+func (w RefillWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+func (w RefillWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+// refillMonitor guarda el estado de la recarga de un tanque
+type refillMonitor struct {
+	mu          sync.Mutex
+	state       RefillState
+	failures    int // Intentos fallidos seguidos
+	lastError   string
+	lastErrorAt time.Time
+	nextAttempt time.Time
+	lastRefill  time.Time // Cuándo se alcanzó por última vez la marca alta
+}
+
+// RefillStatus es la vista del monitor de recarga en /tanks/:name/refill
+type RefillStatus struct {
+	Tank          string      `json:"tank"`
+	State         RefillState `json:"state"`
+	Level         int16       `json:"level"`
+	LowWatermark  int16       `json:"low_watermark"`
+	HighWatermark int16       `json:"high_watermark"`
+	Source        string      `json:"source"`
+	Windows       []string    `json:"windows,omitempty"`
+	InWindow      bool        `json:"in_window"`
+	Failures      int         `json:"consecutive_failures"`
+	LastError     string      `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time  `json:"last_error_at,omitempty"`
+	NextAttempt   *time.Time  `json:"next_attempt_at,omitempty"`
+	LastRefill    *time.Time  `json:"last_refill_at,omitempty"`
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (t *Tank) refillStatus() RefillStatus {
+	now := clock.Now()
+	level := t.GetCapacity()
+	m := &t.refill
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := RefillStatus{
+		Tank:          t.name,
+		State:         m.state,
+		Level:         level,
+		LowWatermark:  t.lowWatermark,
+		HighWatermark: t.highWatermark,
+		Source:        t.source,
+		InWindow:      t.inRefillWindow(now),
+		Failures:      m.failures,
+		LastError:     m.lastError,
+		LastErrorAt:   optionalTime(m.lastErrorAt),
+		LastRefill:    optionalTime(m.lastRefill),
+	}
+	if m.state == RefillBackoff {
+		status.NextAttempt = optionalTime(m.nextAttempt)
+	}
+	for _, window := range t.windows {
+		status.Windows = append(status.Windows, window.String())
+	}
+	return status
+}
+
+// inRefillWindow indica si a la hora now se permite recargar; sin ventanas
+// configuradas se permite siempre
+func (t *Tank) inRefillWindow(now time.Time) bool {
+	if len(t.windows) == 0 {
+		return true
+	}
+	for _, window := range t.windows {
+		if window.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Función para gestionar el proceso de recarga. Con histéresis: la recarga empieza
+// cuando el nivel baja de la marca baja y sigue, por tandas, hasta llegar a la
+// marca alta. Solo se pide agua dentro de las ventanas de recarga y, si el
+// proveedor falla, se espera cada vez más antes de reintentar. Termina, cortando
+// la recarga en curso, cuando se cancela ctx.
+func (t *Tank) MonitorAndRefill(ctx context.Context, bank *Bank) {
+	if t.source == SourceNone {
+		t.setRefillState(RefillDisabled)
+		return
+	}
+	t.setRefillState(RefillIdle)
+	for {
+		wait := t.checkRefill(ctx, bank)
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(wait):
+		}
+	}
+}
+
+func (t *Tank) setRefillState(state RefillState) {
+	t.refill.mu.Lock()
+	t.refill.state = state
+	t.refill.mu.Unlock()
+}
+
+// checkRefill revisa el tanque, pide una tanda de agua si corresponde y devuelve
+// cuánto esperar antes de la siguiente revisión
+func (t *Tank) checkRefill(ctx context.Context, bank *Bank) time.Duration {
+	level := t.GetCapacity()
+	now := clock.Now()
+	m := &t.refill
+
+	m.mu.Lock()
+	state := m.state
+	switch {
+	case level >= t.highWatermark:
+		if state != RefillIdle {
+			m.lastRefill = now
+			fmt.Printf("El tanque %s llegó a la marca alta (%d).\n", t.name, level)
+		}
+		m.state = RefillIdle
+	case state == RefillIdle && level >= t.lowWatermark:
+	case !t.inRefillWindow(now):
+		if state != RefillWaitingWindow {
+			fmt.Printf("El tanque %s necesita agua pero está fuera de su horario de recarga.\n", t.name)
+		}
+		m.state = RefillWaitingWindow
+	case state == RefillBackoff && now.Before(m.nextAttempt):
+	default:
+		if state == RefillIdle {
+			fmt.Printf("El nivel del tanque %s es bajo (%d). Iniciando recarga...\n", t.name, level)
+		}
+		m.state = RefillActive
+	}
+	active := m.state == RefillActive
+	m.mu.Unlock()
+
+	if !active {
+		return RefillCheckInterval
+	}
+
+	var err error
+	if t.source == SourceSAPAM {
+		err = t.refillFromSAPAM(ctx, level)
+	} else {
+		err = t.refillFromTank(bank, level)
+	}
+	if ctx.Err() != nil {
+		return 0
+	}
+	if errors.Is(err, errTankFull) {
+		// No cabe otro bloque: el tanque está tan lleno como puede llegar con SAPAM
+		m.mu.Lock()
+		m.state = RefillIdle
+		m.failures = 0
+		m.lastRefill = clock.Now()
+		m.mu.Unlock()
+		fmt.Printf("El tanque %s no tiene espacio para otro bloque (%d). Recarga terminada.\n", t.name, t.GetCapacity())
+		return RefillCheckInterval
+	}
+	if err != nil {
+		return t.refillFailed(err)
+	}
+
+	m.mu.Lock()
+	m.failures = 0
+	m.mu.Unlock()
+	// Revisar de inmediato: si aún no se llega a la marca alta se pide otra tanda
+	return 0
+}
+
+// refillFailed registra el error y pasa el monitor a espera con retroceso
+// exponencial; devuelve la espera
+func (t *Tank) refillFailed(err error) time.Duration {
+	m := &t.refill
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures++
+	backoff := t.backoffMin << min(m.failures-1, 16)
+	if backoff > t.backoffMax || backoff <= 0 {
+		backoff = t.backoffMax
+	}
+	now := clock.Now()
+	m.state = RefillBackoff
+	m.lastError = err.Error()
+	m.lastErrorAt = now
+	m.nextAttempt = now.Add(backoff)
+	fmt.Printf("Error al recargar el tanque %s (intento %d): %v. Reintento en %v\n", t.name, m.failures, err, backoff)
+	return backoff
+}
+
+// refillFromSAPAM pide a SAPAM los bloques que faltan para la marca alta, sin
+// pasar de REFILL_QUANTITY por tanda ni de los bloques completos que caben en el
+// tanque. Devuelve errTankFull si no cabe ninguno o el tanque se llenó sin que
+// llegara ningún bloque.
+func (t *Tank) refillFromSAPAM(ctx context.Context, level int16) error {
+	blocks := min(REFILL_QUANTITY, (int(t.highWatermark-level)+BLOCK_SIZE-1)/BLOCK_SIZE, int(t.freeRoom())/BLOCK_SIZE)
+	if blocks <= 0 {
+		return errTankFull
+	}
+	summary, err := t.fillFrom(ctx, blocks)
+	if errors.Is(err, errTankFull) {
+		fmt.Printf("El tanque %s ha alcanzado su capacidad máxima durante la recarga.\n", t.name)
+		if summary.Delivered == 0 {
+			return errTankFull
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if summary.Delivered == 0 {
+		return fmt.Errorf("SAPAM no entregó agua (%s)", summary.Reason)
+	}
+	if summary.Reason != stream.ReasonCompleted {
+		fmt.Printf("Recarga incompleta (%s): %d de %d unidades\n", summary.Reason, summary.Delivered, summary.Requested)
+	}
+	return nil
+}
+
+// refillFromTank bombea del tanque de origen lo que falta para la marca alta, sin
+// pasar de REFILL_QUANTITY bloques por tanda ni de lo que tenga el origen
+func (t *Tank) refillFromTank(bank *Bank, level int16) error {
+	amount := min(t.highWatermark-level, t.freeRoom(), REFILL_QUANTITY*BLOCK_SIZE, bank.Get(t.source).GetCapacity())
+	if amount <= 0 {
+		return fmt.Errorf("%w: %s", errSourceEmpty, t.source)
+	}
+	return bank.Transfer(t.source, t.name, amount)
+}
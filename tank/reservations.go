@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+const (
+	DefaultReservationTTL = 5 * time.Minute // Vigencia de una reserva si no se indica ttl
+	MaxReservationTTL     = 24 * time.Hour
+	ReservationRetention  = 1 * time.Hour // Lo que se conserva una reserva cerrada para consultarla
+)
+
+// ReservationState es la etapa de una reserva de agua
+type ReservationState string
+
+const (
+	ReservationActive    ReservationState = "active"    // El agua sigue apartada
+	ReservationConsumed  ReservationState = "consumed"  // Se entregó toda el agua reservada
+	ReservationCancelled ReservationState = "cancelled" // El consumidor la canceló
+	ReservationExpired   ReservationState = "expired"   // Venció antes de usarse por completo
+)
+
+var (
+	errUnknownReservation = errors.New("reserva no encontrada")
+	errReservationClosed  = errors.New("la reserva ya no está activa")
+	errReservationQuota   = errors.New("la cuota del consumidor no alcanza para la reserva")
+	errReservationOwner   = errors.New("la reserva pertenece a otro consumidor")
+	errReservationNoName  = errors.New("no caben más consumidores no configurados; la reserva no puede quedar a nombre de anonymous")
+)
+
+// Reservation aparta agua del banco para un consumidor durante un tiempo. El agua
+// apartada solo se entrega con /supply?reservation=ID; al cancelarse o vencer,
+// lo que quede vuelve al suministro normal y a la cuota del consumidor.
+type Reservation struct {
+	ID        string           `json:"id"`
+	Consumer  string           `json:"consumer"`
+	Quantity  int              `json:"quantity"`
+	Remaining int              `json:"remaining"`
+	State     ReservationState `json:"state"`
+	CreatedAt time.Time        `json:"created_at"`
+	ExpiresAt time.Time        `json:"expires_at"`
+	ClosedAt  *time.Time       `json:"closed_at,omitempty"`
+
+	consumer *Consumer
+	streams  int // Suministros abiertos contra la reserva; mientras haya, no vence
+	timer    *clock.Timer
+}
+
+// Reservations registra las reservas del banco
+type Reservations struct {
+	mu           sync.Mutex
+	bank         *Bank
+	reservations map[string]*Reservation
+	nextID       int
+}
+
+func NewReservations(bank *Bank) *Reservations {
+	return &Reservations{bank: bank, reservations: map[string]*Reservation{}}
+}
+
+// Create aparta quantity unidades del banco y de la cuota del consumidor durante ttl
+func (r *Reservations) Create(consumer *Consumer, quantity int, ttl time.Duration) (Reservation, error) {
+	if granted := consumer.reserveQuota(quantity); granted < quantity {
+		consumer.settle(granted, 0)
+		return Reservation{}, errReservationQuota
+	}
+	if err := r.bank.Reserve(quantity); err != nil {
+		consumer.settle(quantity, 0)
+		return Reservation{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	now := clock.Now()
+	reservation := &Reservation{
+		ID:        fmt.Sprintf("res-%d", r.nextID),
+		Consumer:  consumer.Name,
+		Quantity:  quantity,
+		Remaining: quantity,
+		State:     ReservationActive,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		consumer:  consumer,
+	}
+	r.reservations[reservation.ID] = reservation
+	consumer.holdReservation()
+	id := reservation.ID
+	reservation.timer = clock.AfterFunc(ttl, func() { r.expire(id) })
+	fmt.Printf("Reserva %s: %d unidades de agua para %s hasta %s\n", id, quantity, consumer.Name, reservation.ExpiresAt.Format(time.RFC3339))
+	return *reservation, nil
+}
+
+// Get devuelve una copia de la reserva
+func (r *Reservations) Get(id string) (Reservation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation, ok := r.reservations[id]
+	if !ok {
+		return Reservation{}, false
+	}
+	return *reservation, true
+}
+
+// List devuelve las reservas ordenadas de la más reciente a la más vieja; con
+// activeOnly solo las que siguen apartando agua
+func (r *Reservations) List(activeOnly bool) []Reservation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := []Reservation{}
+	for _, reservation := range r.reservations {
+		if activeOnly && reservation.State != ReservationActive {
+			continue
+		}
+		list = append(list, *reservation)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Cancel libera lo que quede de la reserva
+func (r *Reservations) Cancel(id string) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation, ok := r.reservations[id]
+	if !ok {
+		return Reservation{}, errUnknownReservation
+	}
+	if reservation.State != ReservationActive {
+		return *reservation, errReservationClosed
+	}
+	r.closeLocked(reservation, ReservationCancelled)
+	return *reservation, nil
+}
+
+// Transfer pasa lo que queda de la reserva de from a to, p. ej. cuando una lavadora
+// delega su trabajo en otra. La cuota de to debe alcanzar para lo que queda; lo
+// apartado vuelve a la cuota de from.
+func (r *Reservations) Transfer(id string, from *Consumer, to *Consumer) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation, ok := r.reservations[id]
+	if !ok {
+		return Reservation{}, errUnknownReservation
+	}
+	if reservation.Consumer != from.Name {
+		return Reservation{}, errReservationOwner
+	}
+	if reservation.State != ReservationActive {
+		return *reservation, errReservationClosed
+	}
+	if to.Name == from.Name {
+		return *reservation, nil
+	}
+	if granted := to.reserveQuota(reservation.Remaining); granted < reservation.Remaining {
+		to.settle(granted, 0)
+		return *reservation, errReservationQuota
+	}
+	reservation.consumer.settle(reservation.Remaining, 0)
+	reservation.consumer.releaseReservation()
+	to.holdReservation()
+	reservation.consumer = to
+	reservation.Consumer = to.Name
+	fmt.Printf("Reserva %s: %d unidades de agua pasan de %s a %s\n", id, reservation.Remaining, from.Name, to.Name)
+	return *reservation, nil
+}
+
+// expire vence la reserva; si hay un suministro abierto contra ella se deja para
+// cuando termine
+func (r *Reservations) expire(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation, ok := r.reservations[id]
+	if !ok || reservation.State != ReservationActive || reservation.streams > 0 {
+		return
+	}
+	r.closeLocked(reservation, ReservationExpired)
+}
+
+// closeLocked cierra la reserva y devuelve al banco y a la cuota lo que no se
+// entregó. La reserva se sigue pudiendo consultar durante ReservationRetention;
+// requiere r.mu tomado
+func (r *Reservations) closeLocked(reservation *Reservation, state ReservationState) {
+	now := clock.Now()
+	reservation.State = state
+	reservation.ClosedAt = &now
+	reservation.timer.Stop()
+	reservation.consumer.releaseReservation()
+	if reservation.Remaining > 0 {
+		r.bank.Unreserve(reservation.Remaining)
+		reservation.consumer.settle(reservation.Remaining, 0)
+		fmt.Printf("Se cerró la reserva %s (%s): se liberaron %d unidades de agua\n", reservation.ID, state, reservation.Remaining)
+	}
+	id := reservation.ID
+	clock.AfterFunc(ReservationRetention, func() { r.forget(id) })
+}
+
+// forget descarta una reserva cerrada cuando vence su retención. Si todavía hay
+// un suministro abierto contra ella, espera otra retención.
+func (r *Reservations) forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation, ok := r.reservations[id]
+	if !ok || reservation.State == ReservationActive {
+		return
+	}
+	if reservation.streams > 0 {
+		clock.AfterFunc(ReservationRetention, func() { r.forget(id) })
+		return
+	}
+	delete(r.reservations, id)
+}
+
+// Open registra un suministro contra la reserva del consumidor; devuelve la copia
+// de la reserva para saber cuánto queda
+func (r *Reservations) Open(id string, consumer *Consumer) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation, ok := r.reservations[id]
+	if !ok {
+		return Reservation{}, errUnknownReservation
+	}
+	if reservation.Consumer != consumer.Name {
+		return Reservation{}, errReservationOwner
+	}
+	if reservation.State != ReservationActive {
+		return *reservation, errReservationClosed
+	}
+	reservation.streams++
+	return *reservation, nil
+}
+
+// Close termina un suministro abierto con Open y vence la reserva si ya pasó su hora
+func (r *Reservations) Close(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation := r.reservations[id]
+	reservation.streams--
+	if reservation.streams == 0 && reservation.State == ReservationActive && !clock.Now().Before(reservation.ExpiresAt) {
+		r.closeLocked(reservation, ReservationExpired)
+	}
+}
+
+// Draw entrega hasta amount unidades de la reserva. La cuota ya se descontó al
+// reservar, así que solo se registra la entrega.
+func (r *Reservations) Draw(id string, amount int16) (*Tank, int16, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation := r.reservations[id]
+	if reservation.State != ReservationActive {
+		return nil, 0, errReservationClosed
+	}
+	tank, drawn, err := r.bank.DrawReserved(int16(min(int(amount), reservation.Remaining)))
+	if err != nil {
+		return nil, 0, err
+	}
+	reservation.Remaining -= int(drawn)
+	reservation.consumer.settle(int(drawn), int(drawn))
+	if reservation.Remaining == 0 {
+		r.closeLocked(reservation, ReservationConsumed)
+	}
+	return tank, drawn, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+const (
+	LaundryURLEnv     = "WASHER_LAUNDRY_URL" // Servicio al que se avisa de las fallas
+	DefaultLaundryURL = "http://localhost:4010"
+	FaultNotifyPath   = "/v1/washer-faults"
+)
+
+// WasherState indica si la lavadora puede recibir trabajos
+type WasherState string
+
+const (
+	StateOperational WasherState = "operational"
+	StateFaulted     WasherState = "faulted"     // Se descompuso; necesita /repair
+	StateMaintenance WasherState = "maintenance" // Fuera de servicio a propósito
+)
+
+// FaultKind es el tipo de falla de una lavadora
+type FaultKind string
+
+const (
+	FaultStuckDoor   FaultKind = "stuck_door"
+	FaultLeak        FaultKind = "leak"     // Pierde toda el agua
+	FaultOverheat    FaultKind = "overheat" // Pierde toda la energía
+	FaultMaintenance FaultKind = "maintenance"
+)
+
+// randomFaults son las fallas que puede sortear el modelo de probabilidad
+var randomFaults = []FaultKind{FaultStuckDoor, FaultLeak, FaultOverheat}
+
+func validFault(kind FaultKind) bool {
+	for _, fault := range randomFaults {
+		if fault == kind {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	errWasherDown        = errors.New("la lavadora ya está fuera de servicio")
+	errWasherOperational = errors.New("la lavadora no necesita reparación")
+)
+
+// operationalLocked indica si la lavadora puede tomar trabajos; requiere w.mu tomado
+func (w *Washer) operationalLocked() bool {
+	return w.state == StateOperational
+}
+
+// rollFault sortea si la etapa que empieza tendrá una falla y en qué momento
+func (w *Washer) rollFault(duration time.Duration) (FaultKind, time.Duration, bool) {
+	w.mu.Lock()
+	probability := w.failureProbability
+	w.mu.Unlock()
+
+	if probability <= 0 || rand.Float64() >= probability {
+		return "", 0, false
+	}
+	kind := randomFaults[rand.IntN(len(randomFaults))]
+	return kind, time.Duration(rand.Int64N(int64(duration) + 1)), true
+}
+
+// breakDown saca la lavadora de servicio por una falla o por mantenimiento. El
+// trabajo en curso lo detiene runStages al ver cerrado el canal broken.
+func (w *Washer) breakDown(kind FaultKind) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.operationalLocked() {
+		return errWasherDown
+	}
+	now := clock.Now()
+	w.operatingTime += now.Sub(w.upSince)
+	w.downSince = now
+	w.fault = kind
+	if kind == FaultMaintenance {
+		w.state = StateMaintenance
+	} else {
+		w.state = StateFaulted
+		w.failures++
+		w.lastFailureAt = &now
+	}
+
+	switch kind {
+	case FaultLeak:
+		w.waterLevel = 0
+	case FaultOverheat:
+		w.energyLevel = 0
+	}
+	close(w.broken)
+	w.stopRefillsLocked()
+	w.notifyLocked()
+	fmt.Printf("%s quedó fuera de servicio: %s\n", w.name, kind)
+	return nil
+}
+
+// repair devuelve la lavadora al servicio
+func (w *Washer) repair() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.operationalLocked() {
+		return errWasherOperational
+	}
+	now := clock.Now()
+	w.downtime += now.Sub(w.downSince)
+	w.repairs++
+	w.state = StateOperational
+	w.fault = ""
+	w.upSince = now
+	w.broken = make(chan struct{})
+	w.startRefillsLocked()
+	w.notifyLocked()
+	fmt.Printf("%s volvió al servicio\n", w.name)
+	return nil
+}
+
+// Reliability resume las fallas de una lavadora o de la flota
+type Reliability struct {
+	Failures      int        `json:"failures"`
+	Repairs       int        `json:"repairs"`
+	UptimeSeconds float64    `json:"uptime_seconds"`
+	MTBFSeconds   *float64   `json:"mtbf_seconds"` // Tiempo medio entre fallas; nulo sin fallas
+	MTTRSeconds   *float64   `json:"mttr_seconds"` // Tiempo medio de reparación; nulo sin reparaciones
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+}
+
+// reliabilityLocked calcula las estadísticas; requiere w.mu tomado
+func (w *Washer) reliabilityLocked() Reliability {
+	uptime := w.operatingTime
+	if w.operationalLocked() {
+		uptime += clock.Since(w.upSince)
+	}
+	return newReliability(w.failures, w.repairs, uptime, w.downtime, w.lastFailureAt)
+}
+
+func newReliability(failures, repairs int, uptime, downtime time.Duration, lastFailure *time.Time) Reliability {
+	stats := Reliability{Failures: failures, Repairs: repairs, UptimeSeconds: uptime.Seconds(), LastFailureAt: lastFailure}
+	if failures > 0 {
+		mtbf := uptime.Seconds() / float64(failures)
+		stats.MTBFSeconds = &mtbf
+	}
+	if repairs > 0 {
+		mttr := downtime.Seconds() / float64(repairs)
+		stats.MTTRSeconds = &mttr
+	}
+	return stats
+}
+
+// FleetReliability suma las estadísticas de todas las lavadoras
+type FleetReliability struct {
+	Reliability
+	Washers map[string]Reliability `json:"washers"`
+}
+
+func fleetReliability() FleetReliability {
+	var failures, repairs int
+	var uptime, downtime time.Duration
+	var lastFailure *time.Time
+	washers := map[string]Reliability{}
+
+	for _, washer := range fleet.All() {
+		washer.mu.Lock()
+		stats := washer.reliabilityLocked()
+		failures += washer.failures
+		repairs += washer.repairs
+		downtime += washer.downtime
+		washer.mu.Unlock()
+
+		uptime += time.Duration(stats.UptimeSeconds * float64(time.Second))
+		if stats.LastFailureAt != nil && (lastFailure == nil || stats.LastFailureAt.After(*lastFailure)) {
+			lastFailure = stats.LastFailureAt
+		}
+		washers[washer.name] = stats
+	}
+	return FleetReliability{
+		Reliability: newReliability(failures, repairs, uptime, downtime, lastFailure),
+		Washers:     washers,
+	}
+}
+
+// FaultEvent es el aviso que recibe el servicio de lavandería cuando una falla
+// interrumpe un trabajo
+type FaultEvent struct {
+	Washer string    `json:"washer"`
+	JobID  string    `json:"job_id"`
+	Fault  FaultKind `json:"fault"`
+	At     time.Time `json:"at"`
+}
+
+// notifyLaundry avisa de la falla para que la orden se vuelva a despachar sin
+// esperar a la siguiente consulta. Si el aviso no llega, el servicio de lavandería
+// igual verá el trabajo fallido al consultarlo.
+func notifyLaundry(event FaultEvent) {
+	baseURL := os.Getenv(LaundryURLEnv)
+	if baseURL == "" {
+		baseURL = DefaultLaundryURL
+	}
+
+	body, _ := json.Marshal(event)
+	resp, err := http.Post(baseURL+FaultNotifyPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("No se pudo avisar de la falla de %s: %v\n", event.Washer, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		fmt.Printf("El servicio de lavandería rechazó el aviso de falla de %s: %d\n", event.Washer, resp.StatusCode)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FleetConfigEnv         = "WASHER_FLEET_CONFIG" // Ruta del archivo YAML con la flota
+	DefaultFleetConfigPath = "washers.yaml"
+	DefaultCapacityKg      = 8
+)
+
+var (
+	errWasherNotFound = errors.New("lavadora no encontrada")
+	errWasherExists   = errors.New("ya existe una lavadora con ese nombre")
+	errWasherBusy     = errors.New("la lavadora está ocupada")
+)
+
+// WasherConfig describe una lavadora de la flota. Los campos en cero toman el
+// valor de la sección defaults del archivo.
+type WasherConfig struct {
+	Name       string   `yaml:"name" json:"name"`
+	MaxWater   int      `yaml:"max_water" json:"max_water"`
+	MaxEnergy  int      `yaml:"max_energy" json:"max_energy"`
+	CapacityKg float64  `yaml:"capacity_kg" json:"capacity_kg"`
+	Programs   []string `yaml:"programs" json:"programs"`
+	// Probabilidad de que la lavadora se descomponga en cada etapa (0 a 1)
+	FailureProbability float64 `yaml:"failure_probability" json:"failure_probability"`
+	// LoadTypes se conserva por compatibilidad: si no se indican programas, se
+	// usan los programas equivalentes a estos tipos de carga
+	LoadTypes []int `yaml:"load_types,omitempty" json:"load_types,omitempty"`
+}
+
+// FleetConfig es el contenido del archivo de configuración de la flota
+type FleetConfig struct {
+	Strategy SelectionStrategy `yaml:"strategy"` // Estrategia de selección por defecto
+	Defaults WasherConfig      `yaml:"defaults"`
+	Washers  []WasherConfig    `yaml:"washers"`
+}
+
+// builtinDefaults son los valores que usaba la flota antes de ser configurable
+func builtinDefaults() WasherConfig {
+	return WasherConfig{
+		MaxWater:   MaxWaterPerWasher,
+		MaxEnergy:  MaxEnergyPerWasher,
+		CapacityKg: DefaultCapacityKg,
+		Programs:   programNames(),
+	}
+}
+
+// builtinFleet reproduce las tres lavadoras originales cuando no hay archivo
+func builtinFleet() FleetConfig {
+	return FleetConfig{
+		Washers: []WasherConfig{{Name: "washer1"}, {Name: "washer2"}, {Name: "washer3"}},
+	}
+}
+
+// withDefaults completa los campos vacíos con los de defaults
+func (c WasherConfig) withDefaults(defaults WasherConfig) WasherConfig {
+	if c.MaxWater == 0 {
+		c.MaxWater = defaults.MaxWater
+	}
+	if c.MaxEnergy == 0 {
+		c.MaxEnergy = defaults.MaxEnergy
+	}
+	if c.CapacityKg == 0 {
+		c.CapacityKg = defaults.CapacityKg
+	}
+	if len(c.Programs) == 0 && len(c.LoadTypes) > 0 {
+		for _, loadType := range c.LoadTypes {
+			if name, ok := programForLoad[loadType]; ok {
+				c.Programs = append(c.Programs, name)
+			}
+		}
+	}
+	if len(c.Programs) == 0 {
+		c.Programs = defaults.Programs
+	}
+	if c.FailureProbability == 0 {
+		c.FailureProbability = defaults.FailureProbability
+	}
+	c.LoadTypes = nil
+	return c
+}
+
+func (c WasherConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("la lavadora necesita un nombre")
+	}
+	if c.MaxWater <= 0 || c.MaxEnergy <= 0 {
+		return fmt.Errorf("%s: max_water y max_energy deben ser positivos", c.Name)
+	}
+	if c.CapacityKg <= 0 {
+		return fmt.Errorf("%s: capacity_kg debe ser positivo", c.Name)
+	}
+	if c.FailureProbability < 0 || c.FailureProbability > 1 {
+		return fmt.Errorf("%s: failure_probability debe estar entre 0 y 1", c.Name)
+	}
+	for _, loadType := range c.LoadTypes {
+		if _, ok := programForLoad[loadType]; !ok {
+			return fmt.Errorf("%s: tipo de carga desconocido %d", c.Name, loadType)
+		}
+	}
+	for _, name := range c.Programs {
+		program, ok := washPrograms[name]
+		if !ok {
+			return fmt.Errorf("%s: programa desconocido %q", c.Name, name)
+		}
+		// Cada etapa toma sus recursos de una vez, así que debe caber en la lavadora
+		for _, stage := range program.Stages {
+			if stage.Water > c.MaxWater || stage.Energy > c.MaxEnergy {
+				return fmt.Errorf("%s: la etapa %s del programa %s no cabe en la lavadora", c.Name, stage.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadFleetConfig lee la flota del archivo indicado en WASHER_FLEET_CONFIG o de
+// washers.yaml. Si no se indicó archivo y no existe, usa la flota original.
+func LoadFleetConfig() (FleetConfig, error) {
+	path := os.Getenv(FleetConfigEnv)
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFleetConfigPath
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		fmt.Printf("No se encontró %s; se usará la flota por defecto\n", path)
+		return builtinFleet(), nil
+	}
+	if err != nil {
+		return FleetConfig{}, err
+	}
+
+	var config FleetConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return FleetConfig{}, fmt.Errorf("%s: %v", path, err)
+	}
+	fmt.Printf("Flota cargada de %s: %d lavadoras\n", path, len(config.Washers))
+	return config, nil
+}
+
+// Fleet es el conjunto de lavadoras; se puede modificar en tiempo de ejecución
+type Fleet struct {
+	mu       sync.RWMutex
+	washers  []*Washer
+	defaults WasherConfig
+	strategy SelectionStrategy
+	nextTurn int // Posición desde la que sigue el turno rotativo
+}
+
+func NewFleet(config FleetConfig) (*Fleet, error) {
+	f := &Fleet{defaults: config.Defaults.withDefaults(builtinDefaults()), strategy: DefaultStrategy}
+	if config.Strategy != "" {
+		if err := f.SetStrategy(config.Strategy); err != nil {
+			return nil, err
+		}
+	}
+	for _, washerConfig := range config.Washers {
+		if _, err := f.Add(washerConfig); err != nil {
+			return nil, err
+		}
+	}
+	if len(f.washers) == 0 {
+		return nil, fmt.Errorf("la flota no tiene lavadoras")
+	}
+	return f, nil
+}
+
+var fleet *Fleet
+
+// All devuelve una copia de la lista de lavadoras
+func (f *Fleet) All() []*Washer {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	washers := make([]*Washer, len(f.washers))
+	copy(washers, f.washers)
+	return washers
+}
+
+func (f *Fleet) Get(name string) *Washer {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, washer := range f.washers {
+		if washer.name == name {
+			return washer
+		}
+	}
+	return nil
+}
+
+// Add incorpora una lavadora nueva, llena de agua y energía
+func (f *Fleet) Add(config WasherConfig) (*Washer, error) {
+	config = config.withDefaults(f.defaults)
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, washer := range f.washers {
+		if washer.name == config.Name {
+			return nil, errWasherExists
+		}
+	}
+	washer := newWasher(config)
+	f.washers = append(f.washers, washer)
+	return washer, nil
+}
+
+// Remove quita una lavadora que no esté lavando
+func (f *Fleet) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, washer := range f.washers {
+		if washer.name != name {
+			continue
+		}
+		washer.mu.Lock()
+		busy := washer.busy
+		washer.mu.Unlock()
+		if busy {
+			return errWasherBusy
+		}
+		f.washers = append(f.washers[:i], f.washers[i+1:]...)
+		washer.stop()
+		return nil
+	}
+	return errWasherNotFound
+}
+
+// Retire deja de asignar trabajos a la lavadora; el que tenga en curso termina normalmente
+func (f *Fleet) Retire(name string) (*Washer, error) {
+	washer := f.Get(name)
+	if washer == nil {
+		return nil, errWasherNotFound
+	}
+	washer.mu.Lock()
+	washer.retired = true
+	washer.mu.Unlock()
+	return washer, nil
+}
+
+// Supports indica si alguna lavadora activa admite el programa
+func (f *Fleet) Supports(program string) bool {
+	for _, washer := range f.All() {
+		washer.mu.Lock()
+		retired := washer.retired
+		washer.mu.Unlock()
+		if !retired && washer.supports(program) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxLoadKg devuelve la mayor carga en kg que puede lavar con el programa alguna
+// lavadora activa; cero si ninguna lo admite
+func (f *Fleet) MaxLoadKg(program string) float64 {
+	maxKg := 0.0
+	for _, washer := range f.All() {
+		washer.mu.Lock()
+		if !washer.retired && washer.supports(program) {
+			maxKg = max(maxKg, washer.capacityKg)
+		}
+		washer.mu.Unlock()
+	}
+	return maxKg
+}
+
+// MaxLoadKgByProgram devuelve MaxLoadKg para cada programa de lavado
+func (f *Fleet) MaxLoadKgByProgram() map[string]float64 {
+	limits := make(map[string]float64, len(washPrograms))
+	for _, name := range programNames() {
+		limits[name] = f.MaxLoadKg(name)
+	}
+	return limits
+}
+
+// Capacity cuenta las lavadoras activas y cuántas están libres en este momento,
+// junto con la mayor capacidad en kg entre las activas
+func (f *Fleet) Capacity() (total int, available int, maxKg float64) {
+	for _, washer := range f.All() {
+		washer.mu.Lock()
+		if !washer.retired {
+			total++
+			maxKg = max(maxKg, washer.capacityKg)
+			if !washer.busy && washer.operationalLocked() {
+				available++
+			}
+		}
+		washer.mu.Unlock()
+	}
+	return total, available, maxKg
+}
+
+// WasherInfo es la vista de configuración de una lavadora en los endpoints de administración
+type WasherInfo struct {
+	WasherConfig
+	Busy    bool `json:"busy"`
+	Retired bool `json:"retired"`
+}
+
+func (w *Washer) info() WasherInfo {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return WasherInfo{
+		WasherConfig: WasherConfig{
+			Name:       w.name,
+			MaxWater:   w.maxWater,
+			MaxEnergy:  w.maxEnergy,
+			CapacityKg: w.capacityKg,
+			Programs:   w.programs,
+
+			FailureProbability: w.failureProbability,
+		},
+		Busy:    w.busy,
+		Retired: w.retired,
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+)
+
+// JobRetention es lo que se conserva un trabajo terminado para que la lavandería
+// pueda consultar su resultado antes de descartarlo
+const JobRetention = 1 * time.Hour
+
+// JobPhase es la etapa en la que se encuentra un trabajo de lavado
+type JobPhase string
+
+const (
+	PhaseFilling JobPhase = "filling"
+	PhaseWashing JobPhase = "washing"
+	PhaseDone    JobPhase = "done"
+	PhaseFailed  JobPhase = "failed"
+	PhaseAborted JobPhase = "aborted"
+)
+
+// Terminal indica si el trabajo ya no cambiará de etapa
+func (p JobPhase) Terminal() bool {
+	return p == PhaseDone || p == PhaseFailed || p == PhaseAborted
+}
+
+// Estado de cada etapa del programa dentro de un trabajo
+const (
+	StagePending = "pending"
+	StageRunning = "running"
+	StageDone    = "done"
+	StageStopped = "stopped" // El trabajo falló o se abortó durante la etapa
+	StageSkipped = "skipped" // El trabajo terminó antes de llegar a la etapa
+)
+
+// JobStage informa el avance de una etapa del programa
+type JobStage struct {
+	StageInfo
+	Status     string     `json:"status"`
+	Washer     string     `json:"washer,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type WashJob struct {
+	ID         string     `json:"id"`
+	LoadType   int        `json:"load_type"`
+	Program    string     `json:"program"`
+	WeightKg   float64    `json:"weight_kg,omitempty"` // Carga total; cero si no se indicó
+	Washer     string     `json:"washer"`
+	Selection  Selection  `json:"selection"` // Cómo se eligió la lavadora actual
+	Phase      JobPhase   `json:"phase"`
+	Stage      string     `json:"stage,omitempty"` // Etapa del programa en curso
+	Stages     []JobStage `json:"stages"`
+	Message    string     `json:"message,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Fault      FaultKind  `json:"fault,omitempty"` // Falla de la lavadora que interrumpió el trabajo
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	done  chan struct{}
+	abort chan struct{}
+}
+
+// JobRegistry guarda los trabajos de lavado creados por POST /jobs. Los IDs
+// llevan un prefijo propio de cada arranque para que una orden restaurada por la
+// lavandería no se confunda con un trabajo nuevo después de reiniciar el servicio.
+type JobRegistry struct {
+	mu     sync.Mutex
+	jobs   map[string]*WashJob
+	boot   string
+	nextID int
+}
+
+func NewJobRegistry() *JobRegistry {
+	// Se usa la hora real: con el reloj simulado en modo manual todos los arranques marcarían lo mismo
+	boot := strconv.FormatInt(time.Now().UnixNano(), 36)
+	return &JobRegistry{jobs: map[string]*WashJob{}, boot: boot}
+}
+
+var jobs = NewJobRegistry()
+
+// Create registra un nuevo trabajo asignado a la lavadora elegida
+func (r *JobRegistry) Create(loadType int, program WashProgram, weightKg float64, washer *Washer, selection Selection) *WashJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stages := make([]JobStage, len(program.Stages))
+	for i, stage := range program.Stages {
+		stages[i] = JobStage{StageInfo: stage.info(), Status: StagePending}
+	}
+
+	r.nextID++
+	now := clock.Now()
+	job := &WashJob{
+		ID:        fmt.Sprintf("job-%s-%d", r.boot, r.nextID),
+		LoadType:  loadType,
+		Program:   program.Name,
+		WeightKg:  weightKg,
+		Stages:    stages,
+		Washer:    washer.name,
+		Selection: selection,
+		Phase:     PhaseFilling,
+		CreatedAt: now,
+		UpdatedAt: now,
+		done:      make(chan struct{}),
+		abort:     make(chan struct{}),
+	}
+	r.jobs[job.ID] = job
+	return job
+}
+
+// Get devuelve una copia del trabajo para que pueda serializarse sin bloqueo
+func (r *JobRegistry) Get(id string) (WashJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return WashJob{}, false
+	}
+	copied := *job
+	copied.Stages = append([]JobStage(nil), job.Stages...)
+	return copied, true
+}
+
+// Wait bloquea hasta que el trabajo termine y devuelve su estado final
+func (r *JobRegistry) Wait(id string) (WashJob, bool) {
+	r.mu.Lock()
+	job, ok := r.jobs[id]
+	r.mu.Unlock()
+	if !ok {
+		return WashJob{}, false
+	}
+
+	<-job.done
+	return r.Get(id)
+}
+
+// Aborted devuelve el canal que se cierra cuando se pide abortar el trabajo
+func (r *JobRegistry) Aborted(id string) <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[id]; ok {
+		return job.abort
+	}
+	return nil
+}
+
+// Abort pide detener un trabajo en curso. La lavadora lo cierra como abortado en
+// cuanto atiende la señal. aborted es false si el trabajo ya había terminado.
+func (r *JobRegistry) Abort(id string) (found bool, aborted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return false, false
+	}
+	if job.Phase.Terminal() {
+		return true, false
+	}
+	select {
+	case <-job.abort:
+	default:
+		close(job.abort)
+	}
+	return true, true
+}
+
+// SetPhase mueve el trabajo a una etapa intermedia con la lavadora que lo atiende
+func (r *JobRegistry) SetPhase(id string, phase JobPhase, washer *Washer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[id]; ok && !job.Phase.Terminal() {
+		job.Phase = phase
+		job.Washer = washer.name
+		job.UpdatedAt = clock.Now()
+	}
+}
+
+// Reassign registra la lavadora que continúa el trabajo tras una delegación
+func (r *JobRegistry) Reassign(id string, washer *Washer, selection Selection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[id]; ok && !job.Phase.Terminal() {
+		job.Washer = washer.name
+		job.Selection = selection
+		job.UpdatedAt = clock.Now()
+	}
+}
+
+// StartStage marca como iniciada la etapa i del programa en la lavadora indicada
+func (r *JobRegistry) StartStage(id string, i int, washer *Washer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok || job.Phase.Terminal() || i >= len(job.Stages) {
+		return
+	}
+	now := clock.Now()
+	job.Phase = PhaseWashing
+	job.Washer = washer.name
+	job.Stage = job.Stages[i].Name
+	job.Stages[i].Status = StageRunning
+	job.Stages[i].Washer = washer.name
+	job.Stages[i].StartedAt = &now
+	job.UpdatedAt = now
+}
+
+// FinishStage marca como terminada la etapa i del programa
+func (r *JobRegistry) FinishStage(id string, i int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok || job.Phase.Terminal() || i >= len(job.Stages) {
+		return
+	}
+	now := clock.Now()
+	job.Stages[i].Status = StageDone
+	job.Stages[i].FinishedAt = &now
+	job.UpdatedAt = now
+}
+
+// Complete marca el trabajo como terminado con éxito
+func (r *JobRegistry) Complete(id string, message string) {
+	r.finish(id, PhaseDone, message, "")
+}
+
+// Fail marca el trabajo como fallido
+func (r *JobRegistry) Fail(id string, reason string) {
+	r.finish(id, PhaseFailed, "", reason)
+}
+
+// FailWithFault marca el trabajo como fallido por una falla de la lavadora
+func (r *JobRegistry) FailWithFault(id string, kind FaultKind, reason string) {
+	r.mu.Lock()
+	if job, ok := r.jobs[id]; ok && !job.Phase.Terminal() {
+		job.Fault = kind
+	}
+	r.mu.Unlock()
+	r.Fail(id, reason)
+}
+
+// MarkAborted cierra el trabajo después de que la lavadora atendió la señal de aborto
+func (r *JobRegistry) MarkAborted(id string) {
+	r.finish(id, PhaseAborted, "", "Trabajo abortado por el cliente")
+}
+
+func (r *JobRegistry) finish(id string, phase JobPhase, message, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok || job.Phase.Terminal() {
+		return
+	}
+	now := clock.Now()
+	for i := range job.Stages {
+		switch job.Stages[i].Status {
+		case StageRunning:
+			job.Stages[i].Status = StageStopped
+			job.Stages[i].FinishedAt = &now
+		case StagePending:
+			job.Stages[i].Status = StageSkipped
+		}
+	}
+	job.Phase = phase
+	job.Stage = ""
+	job.Message = message
+	job.Error = reason
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	close(job.done)
+	clock.AfterFunc(JobRetention, func() { r.forget(id) })
+}
+
+// forget descarta un trabajo terminado cuando vence su retención
+func (r *JobRegistry) forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[id]; ok && job.Phase.Terminal() {
+		delete(r.jobs, id)
+	}
+}
@@ -1,274 +1,598 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
 	"github.com/gin-gonic/gin"
 )
 
 type Washer struct {
 	name        string
+	maxWater    int
+	maxEnergy   int
+	capacityKg  float64
+	programs    []string
 	waterLevel  int
 	energyLevel int
 	mu          sync.Mutex
 	busy        bool
+	retired     bool
+	currentJob  string // Trabajo que ocupa la lavadora; vacío si está libre
+	cycles      int    // Programas completados
+	waterUsed   int    // Agua consumida desde que arrancó el servicio
+	energyUsed  int    // Energía consumida desde que arrancó el servicio
+
+	// Reservas y recargas (ver resources.go)
+	reservedWater   int
+	reservedEnergy  int
+	refillingWater  bool
+	refillingEnergy bool
+	waterRefillErr  error
+	energyRefillErr error
+	changed         chan struct{} // Se cierra cada vez que cambian los niveles o las reservas
+
+	// Los flujos de recarga se cancelan al quitar la lavadora de la flota (ctx), al
+	// salir de servicio o, si salen de la reserva del trabajo, al terminar este
+	ctx                context.Context
+	stop               context.CancelFunc
+	cancelWaterRefill  context.CancelFunc
+	cancelEnergyRefill context.CancelFunc
+
+	// Agua apartada en el tanque para el trabajo en curso
+	tankReservation   string // ID de la reserva; vacío si no hay
+	tankReserved      int    // Lo que queda por recibir de la reserva
+	refillReservation string // Reserva de la que sale la recarga de agua en curso, si sale de una
+
+	// Fallas y mantenimiento (ver faults.go)
+	state              WasherState
+	fault              FaultKind
+	failureProbability float64       // Probabilidad de falla en cada etapa
+	broken             chan struct{} // Se cierra cuando la lavadora sale de servicio
+	upSince            time.Time
+	downSince          time.Time
+	operatingTime      time.Duration // Tiempo en servicio acumulado hasta la última salida
+	downtime           time.Duration
+	failures           int
+	repairs            int
+	lastFailureAt      *time.Time
 }
 
 const (
-	MaxWaterPerWasher    = 80
-	MaxEnergyPerWasher   = 80
-	WaterLoadType1       = 10
-	WaterLoadType2       = 20
-	WaterLoadType3       = 30
-	EnergyLoadType       = 30
-	CycleDuration        = 3 * time.Second
-	TankServerSupply     = "http://localhost:4006/supply?quantity=" // URL del tanque para suministro
-	EnergyServerSupply   = "http://localhost:4008/supply?quantity=" // URL del proveedor de energía
+	MaxWaterPerWasher  = 80
+	MaxEnergyPerWasher = 80
+	TankServerSupply   = "http://localhost:4006/supply?quantity=" // URL del tanque para suministro
+	TankReservations   = "http://localhost:4006/reservations"     // URL del tanque para reservar agua
+	EnergyServerSupply = "http://localhost:4008/supply?quantity=" // URL del proveedor de energía
 )
 
-var washers = []*Washer{
-	{name: "washer1", waterLevel: MaxWaterPerWasher, energyLevel: MaxEnergyPerWasher},
-	{name: "washer2", waterLevel: MaxWaterPerWasher, energyLevel: MaxEnergyPerWasher},
-	{name: "washer3", waterLevel: MaxWaterPerWasher, energyLevel: MaxEnergyPerWasher},
-}
-
-func (w *Washer) useResources(waterAmount, energyAmount int) error {
-	w.mu.Lock()
-	if w.waterLevel < MaxWaterPerWasher {
-		neededWater := MaxWaterPerWasher - w.waterLevel
-		go refillWater(neededWater, w) // Reabastecimiento constante de agua
+func newWasher(config WasherConfig) *Washer {
+	ctx, stop := context.WithCancel(context.Background())
+	return &Washer{
+		name:        config.Name,
+		maxWater:    config.MaxWater,
+		maxEnergy:   config.MaxEnergy,
+		capacityKg:  config.CapacityKg,
+		programs:    config.Programs,
+		waterLevel:  config.MaxWater,
+		energyLevel: config.MaxEnergy,
+		changed:     make(chan struct{}),
+		ctx:         ctx,
+		stop:        stop,
+
+		state:              StateOperational,
+		failureProbability: config.FailureProbability,
+		broken:             make(chan struct{}),
+		upSince:            clock.Now(),
 	}
-	w.mu.Unlock()
+}
 
-	if w.energyLevel < energyAmount {
-		neededEnergy := MaxEnergyPerWasher - w.energyLevel
-		if err := refillEnergyAndDelegate(neededEnergy, w, waterAmount, energyAmount); err != nil {
-			return err
+// Indica si la lavadora admite el programa
+func (w *Washer) supports(program string) bool {
+	for _, supported := range w.programs {
+		if supported == program {
+			return true
 		}
 	}
+	return false
+}
 
-	w.mu.Lock()
-	if w.waterLevel >= waterAmount && w.energyLevel >= energyAmount {
-		w.waterLevel -= waterAmount
-		w.energyLevel -= energyAmount
-		fmt.Printf("%s utilizó %d unidades de agua y %d unidades de energía. Nivel restante de agua: %d, energía: %d\n", w.name, waterAmount, energyAmount, w.waterLevel, w.energyLevel)
-	} else {
-		fmt.Printf("%s no tiene suficientes recursos para completar el ciclo.\n", w.name)
+// releaseWasher deja la lavadora libre al terminar el trabajo y cancela el agua
+// que quedara reservada en el tanque
+func releaseWasher(w *Washer) {
+	if reservation, pending := handOffWasher(w); reservation != "" && pending > 0 {
+		go cancelTankReservation(w.name, reservation)
 	}
-	w.mu.Unlock()
-	return nil
 }
 
-func refillWater(amount int, w *Washer) {
-	resp, err := http.Post(TankServerSupply+strconv.Itoa(amount/10), "application/json", nil)
-	if err != nil {
-		fmt.Printf("%s no pudo obtener agua del tanque: %v\n", w.name, err)
-		return
-	}
-	defer resp.Body.Close()
+// handOffWasher deja la lavadora libre para otro trabajo y corta la recarga que
+// saliera de la reserva del trabajo. Devuelve la reserva del tanque y lo que queda
+// por recibir de ella, para cancelarla o pasarla a la lavadora que siga el trabajo.
+func handOffWasher(w *Washer) (reservation string, pending int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("%s recibió un estado inesperado: %d\n", w.name, resp.StatusCode)
-		return
+	w.busy = false
+	w.currentJob = ""
+	if w.refillReservation != "" {
+		w.cancelWaterRefill()
 	}
+	reservation, pending = w.tankReservation, w.tankReserved
+	w.tankReservation, w.tankReserved = "", 0
+	return reservation, pending
+}
 
-	reader := bufio.NewReader(resp.Body)
+// manageWashing ejecuta el programa. Si una lavadora no consigue los recursos de
+// una etapa, el trabajo continúa desde esa etapa en otra lavadora libre que aún
+// no se haya intentado, elegida con la misma estrategia. La reserva de agua del
+// tanque pasa a la nueva lavadora; solo se cancela cuando el trabajo termina.
+func manageWashing(job *WashJob, washer *Washer, program WashProgram, strategy SelectionStrategy) {
+	var tried []*Washer
+	from := 0
 	for {
-		line, err := reader.ReadBytes('\n')
-		if err != nil {
-			if err.Error() == "EOF" {
+		stopped, err := runStages(job, washer, program, from)
+		if err == nil {
+			return
+		}
+
+		fmt.Printf("%s no puede completar la etapa %s: %v. Delegando a otra lavadora.\n", washer.name, program.Stages[stopped].Name, err)
+		reservation, pending := handOffWasher(washer)
+		tried = append(tried, washer)
+
+		var other *Washer
+		var selection Selection
+		for {
+			other, selection = fleet.Reserve(program, job.WeightKg, strategy, tried...)
+			if other == nil || reservation == "" || pending == 0 {
+				break
+			}
+			moveErr := transferTankReservation(washer.name, other, reservation)
+			if moveErr == nil {
 				break
 			}
-			fmt.Printf("%s encontró un error al leer el agua: %v\n", w.name, err)
+			// La cuota de esa lavadora no alcanza para la reserva; se prueba con otra
+			fmt.Printf("%s no puede continuar el trabajo %s: %v\n", other.name, job.ID, moveErr)
+			releaseWasher(other)
+			tried = append(tried, other)
+		}
+		if other == nil {
+			if reservation != "" && pending > 0 {
+				go cancelTankReservation(washer.name, reservation)
+			}
+			jobs.Fail(job.ID, fmt.Sprintf("No hay lavadoras con recursos para completar el lavado: %v", err))
 			return
 		}
+		jobs.Reassign(job.ID, other, selection)
+		washer, from = other, stopped
+	}
+}
 
-		var payload map[string]int
-		if err := json.Unmarshal(line, &payload); err != nil {
-			fmt.Printf("%s no pudo procesar el bloque de agua: %v\n", w.name, err)
+// runStages ejecuta las etapas del programa a partir de from en la lavadora. Antes
+// de cada etapa reserva el agua y la energía que necesita y solo la inicia cuando
+// los recursos están apartados. Si no los consigue devuelve la etapa en la que se
+// detuvo y un *ResourceError; en cualquier otro caso cierra el trabajo y devuelve nil.
+func runStages(job *WashJob, washer *Washer, program WashProgram, from int) (int, error) {
+	abort := jobs.Aborted(job.ID)
+
+	washer.mu.Lock()
+	washer.currentJob = job.ID
+	broken := washer.broken
+	washer.mu.Unlock()
+	jobs.SetPhase(job.ID, PhaseFilling, washer)
+
+	// La espera de recursos termina tanto si se aborta el trabajo como si la lavadora sale de servicio
+	interrupted := make(chan struct{})
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-abort:
+		case <-broken:
+		case <-finished:
 			return
 		}
+		close(interrupted)
+	}()
+
+	for i := from; i < len(program.Stages); i++ {
+		stage := program.Stages[i]
+
+		reservation, err := washer.Reserve(stage.Water, stage.Energy, ResourceWaitTimeout, interrupted)
+		if errors.Is(err, errReservationAborted) {
+			select {
+			case <-broken:
+				failOnFault(job, washer, stage)
+			default:
+				// Se pidió abortar mientras la lavadora esperaba recursos
+				releaseWasher(washer)
+				fmt.Printf("%s abortó el trabajo %s antes de la etapa %s\n", washer.name, job.ID, stage.Name)
+				jobs.MarkAborted(job.ID)
+			}
+			return i, nil
+		}
+		if err != nil {
+			return i, err
+		}
+		reservation.Commit()
+
+		jobs.StartStage(job.ID, i, washer)
+		fmt.Printf("%s comenzó la etapa %s del programa %s\n", washer.name, stage.Name, program.Name)
 
-		waterReceived := payload["water"]
-		w.mu.Lock()
-		w.waterLevel += waterReceived
-		if w.waterLevel > MaxWaterPerWasher {
-			w.waterLevel = MaxWaterPerWasher
+		// Sortear si la lavadora se descompone durante la etapa
+		var faultTimer *clock.Timer
+		if kind, after, ok := washer.rollFault(stage.Duration); ok {
+			faultTimer = clock.AfterFunc(after, func() { washer.breakDown(kind) })
+		}
+
+		timer := clock.NewTimer(stage.Duration)
+		select {
+		case <-timer.C:
+			if faultTimer != nil {
+				faultTimer.Stop()
+			}
+			jobs.FinishStage(job.ID, i)
+		case <-broken:
+			// La avería pudo llegar de otro lado; sin detener el sorteo, la lavadora
+			// volvería a romperse después de repararla
+			timer.Stop()
+			if faultTimer != nil {
+				faultTimer.Stop()
+			}
+			failOnFault(job, washer, stage)
+			return i, nil
+		case <-abort:
+			timer.Stop()
+			if faultTimer != nil {
+				faultTimer.Stop()
+			}
+			releaseWasher(washer)
+			fmt.Printf("%s abortó la etapa %s del trabajo %s\n", washer.name, stage.Name, job.ID)
+			jobs.MarkAborted(job.ID)
+			return i, nil
 		}
-		fmt.Printf("%s recibió %d unidades de agua. Nivel actual: %d\n", w.name, waterReceived, w.waterLevel)
-		w.mu.Unlock()
 	}
+
+	washer.mu.Lock()
+	washer.cycles++
+	washer.mu.Unlock()
+	releaseWasher(washer)
+	fmt.Printf("%s terminó el programa %s\n", washer.name, program.Name)
+	jobs.Complete(job.ID, fmt.Sprintf("Lavadora %s completó el programa %s con carga tipo %d", washer.name, program.Name, job.LoadType))
+	return len(program.Stages), nil
 }
 
-func refillEnergyAndDelegate(amount int, w *Washer, waterAmount, energyAmount int) error {
-	w.mu.Lock()
-	w.busy = false
-	w.mu.Unlock()
+// failOnFault cierra como fallido el trabajo que interrumpió una falla o el paso a
+// mantenimiento y avisa al servicio de lavandería para que lo vuelva a despachar
+func failOnFault(job *WashJob, washer *Washer, stage ProgramStage) {
+	washer.mu.Lock()
+	kind := washer.fault
+	washer.mu.Unlock()
+	releaseWasher(washer)
 
-	fmt.Printf("%s está recargando energía y delegando la carga...\n", w.name)
-	resp, err := http.Get(EnergyServerSupply + strconv.Itoa(amount))
-	if err != nil {
-		return fmt.Errorf("%s no pudo obtener energía del proveedor: %v", w.name, err)
+	fmt.Printf("%s interrumpió el trabajo %s en la etapa %s: %s\n", washer.name, job.ID, stage.Name, kind)
+	jobs.FailWithFault(job.ID, kind, fmt.Sprintf("La lavadora %s salió de servicio (%s) durante la etapa %s", washer.name, kind, stage.Name))
+	go notifyLaundry(FaultEvent{Washer: washer.name, JobID: job.ID, Fault: kind, At: clock.Now()})
+}
+
+// Valida el tipo de carga y el programa y arranca un trabajo en una lavadora libre.
+// El programa es opcional; sin él se usa el que corresponde al tipo de carga.
+func startJob(c *gin.Context, loadTypeStr string, programName string, weightStr string, strategyName string) (*WashJob, bool) {
+	if loadTypeStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'load' es requerido"})
+		return nil, false
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%s recibió un estado inesperado: %d", w.name, resp.StatusCode)
+	loadType, err := strconv.Atoi(loadTypeStr)
+	if err != nil || loadType < 1 || loadType > 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'load' debe ser 1, 2 o 3"})
+		return nil, false
 	}
 
-	reader := bufio.NewReader(resp.Body)
-	for {
-		line, err := reader.ReadBytes('\n')
-		if err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
-			return fmt.Errorf("%s encontró un error al leer la energía: %v", w.name, err)
-		}
+	program, err := resolveProgram(loadType, programName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "programs": programNames()})
+		return nil, false
+	}
 
-		var payload map[string]int
-		if err := json.Unmarshal(line, &payload); err != nil {
-			return fmt.Errorf("%s no pudo procesar el bloque de energía: %v", w.name, err)
+	// Sin 'kg' la carga ocupa la lavadora completa, como antes de medir en kg
+	weightKg := 0.0
+	if weightStr != "" {
+		weightKg, err = strconv.ParseFloat(weightStr, 64)
+		if err != nil || weightKg <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'kg' debe ser un número positivo"})
+			return nil, false
 		}
+	}
 
-		energyReceived := payload["energy"]
-		w.mu.Lock()
-		w.energyLevel += energyReceived
-		if w.energyLevel > MaxEnergyPerWasher {
-			w.energyLevel = MaxEnergyPerWasher
-		}
-		fmt.Printf("%s recibió %d unidades de energía. Nivel actual: %d\n", w.name, energyReceived, w.energyLevel)
-		w.mu.Unlock()
+	strategy := SelectionStrategy(strategyName)
+	if strategy != "" && !validStrategy(strategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Estrategia desconocida %q", strategyName), "strategies": strategies})
+		return nil, false
 	}
 
-	// Delegar a otra lavadora si es necesario
-	for _, otherWasher := range washers {
-		if otherWasher != w {
-			otherWasher.mu.Lock()
-			if !otherWasher.busy {
-				otherWasher.busy = true
-				otherWasher.mu.Unlock()
-				fmt.Printf("Delegando lavado a %s\n", otherWasher.name)
-				go func() {
-					_ = otherWasher.useResources(waterAmount, energyAmount)
-				}()
-				return nil
-			}
-			otherWasher.mu.Unlock()
-		}
+	if !fleet.Supports(program.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Ninguna lavadora admite el programa %s", program.Name)})
+		return nil, false
+	}
+	if maxKg := fleet.MaxLoadKg(program.Name); weightKg > maxKg {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("La carga de %.1f kg supera la capacidad de las lavadoras (%.1f kg)", weightKg, maxKg), "max_kg": maxKg})
+		return nil, false
+	}
+
+	selectedWasher, selection := fleet.Reserve(program, weightKg, strategy)
+	if selectedWasher == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "No hay lavadoras disponibles"})
+		return nil, false
+	}
+	fmt.Printf("Se eligió %s (%s): %s\n", selectedWasher.name, selection.Strategy, selection.Reason)
+
+	// Apartar en el tanque el agua que el programa va a reponer; si el tanque no
+	// puede cubrirla no se empieza el ciclo
+	water, _, duration := program.Totals()
+	ttl := duration + time.Duration(len(program.Stages))*ResourceWaitTimeout
+	if err := selectedWasher.reserveTankWater(water, ttl); err != nil {
+		releaseWasher(selectedWasher)
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("El tanque no puede cubrir el agua del programa %s: %v", program.Name, err)})
+		return nil, false
 	}
 
-	return nil
+	job := jobs.Create(loadType, program, weightKg, selectedWasher, selection)
+
+	// Iniciar el lavado en una gorutina
+	go manageWashing(job, selectedWasher, program, selection.Strategy)
+	return job, true
 }
 
-func manageWashing(loadType int, washer *Washer, c *gin.Context, done chan string) {
-	var waterNeeded int
-	var energyNeeded int = EnergyLoadType
-
-	switch loadType {
-	case 1:
-		waterNeeded = WaterLoadType1
-	case 2:
-		waterNeeded = WaterLoadType2
-	case 3:
-		waterNeeded = WaterLoadType3
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s recibió una carga inválida", washer.name)})
+// outOfService atiende las rutas que sacan una lavadora de servicio
+func outOfService(c *gin.Context, kind FaultKind) {
+	washer := fleet.Get(c.Param("name"))
+	if washer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errWasherNotFound.Error()})
 		return
 	}
-
-	if err := washer.useResources(waterNeeded, energyNeeded); err != nil {
-		fmt.Printf("%s no puede completar el lavado. Delegando a otra lavadora.\n", washer.name)
-		for _, w := range washers {
-			if w != washer {
-				w.mu.Lock()
-				if !w.busy {
-					w.busy = true
-					w.mu.Unlock()
-					go manageWashing(loadType, w, c, done)
-					return
-				}
-				w.mu.Unlock()
-			}
-		}
-		c.JSON(http.StatusConflict, gin.H{"error": "No hay lavadoras disponibles para completar el lavado"})
+	if err := washer.breakDown(kind); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "washer": washer.status()})
 		return
 	}
+	c.JSON(http.StatusOK, washer.status())
+}
 
-	washer.mu.Lock()
-	washer.busy = true
-	washer.mu.Unlock()
+func main() {
+	if err := clock.Setup(); err != nil {
+		log.Fatalf("Configuración del reloj inválida: %v", err)
+	}
 
-	fmt.Printf("%s comenzó el ciclo de lavado con carga tipo %d\n", washer.name, loadType)
-	time.Sleep(CycleDuration)
-	fmt.Printf("%s terminó el ciclo de lavado\n", washer.name)
+	config, err := LoadFleetConfig()
+	if err != nil {
+		log.Fatalf("No se pudo leer la configuración de la flota: %v", err)
+	}
+	fleet, err = NewFleet(config)
+	if err != nil {
+		log.Fatalf("Configuración de flota inválida: %v", err)
+	}
 
-	washer.mu.Lock()
-	washer.busy = false
-	washer.mu.Unlock()
+	r := gin.Default()
+	clock.RegisterRoutes(r)
 
-done <- fmt.Sprintf("Lavadora %s completó el ciclo de lavado con carga tipo %d", washer.name, loadType)
-}
+	// max_kg_by_program es la mayor carga que admite alguna lavadora con cada
+	// programa; load_programs indica qué programa se usa para cada tipo de carga
+	r.GET("/capacity", func(c *gin.Context) {
+		total, available, maxKg := fleet.Capacity()
+		c.JSON(http.StatusOK, gin.H{
+			"total":             total,
+			"available":         available,
+			"max_kg":            maxKg,
+			"max_kg_by_program": fleet.MaxLoadKgByProgram(),
+			"load_programs":     programForLoad,
+		})
+	})
 
-func main() {
-	r := gin.Default()
+	// Estado actual de cada lavadora y flujo de telemetría para tableros
+	r.GET("/washers", func(c *gin.Context) {
+		c.JSON(http.StatusOK, fleetStatus())
+	})
 
-	r.GET("/start", func(c *gin.Context) {
-		loadTypeStr := c.Query("load")
-		if loadTypeStr == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'load' es requerido"})
+	r.GET("/washers/telemetry", telemetryHandler)
+
+	r.GET("/washers/reliability", func(c *gin.Context) {
+		c.JSON(http.StatusOK, fleetReliability())
+	})
+
+	r.GET("/washers/:name", func(c *gin.Context) {
+		washer := fleet.Get(c.Param("name"))
+		if washer == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": errWasherNotFound.Error()})
 			return
 		}
+		c.JSON(http.StatusOK, washer.status())
+	})
 
-		loadType, err := strconv.Atoi(loadTypeStr)
-		if err != nil || loadType < 1 || loadType > 3 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'load' debe ser 1, 2 o 3"})
+	// Saca una lavadora de servicio; el trabajo en curso se interrumpe y se avisa
+	// al servicio de lavandería para que lo despache de nuevo
+	r.POST("/washers/:name/maintenance", func(c *gin.Context) {
+		outOfService(c, FaultMaintenance)
+	})
+
+	// Simula una falla; útil para probar cómo reacciona el resto del sistema
+	r.POST("/washers/:name/faults", func(c *gin.Context) {
+		var request struct {
+			Kind FaultKind `json:"kind"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || !validFault(request.Kind) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "'kind' debe ser una de las fallas conocidas", "faults": randomFaults})
 			return
 		}
+		outOfService(c, request.Kind)
+	})
 
-		var selectedWasher *Washer
-		for _, washer := range washers {
-			washer.mu.Lock()
-			if !washer.busy {
-				washer.busy = true
-				selectedWasher = washer
-				washer.mu.Unlock()
-				break
-			}
-			washer.mu.Unlock()
+	r.POST("/washers/:name/repair", func(c *gin.Context) {
+		washer := fleet.Get(c.Param("name"))
+		if washer == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": errWasherNotFound.Error()})
+			return
+		}
+		if err := washer.repair(); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "washer": washer.status()})
+			return
+		}
+		c.JSON(http.StatusOK, washer.status())
+	})
+
+	// Lista los programas de lavado con sus etapas
+	r.GET("/programs", func(c *gin.Context) {
+		programs := make([]ProgramInfo, 0, len(washPrograms))
+		for _, name := range programNames() {
+			programs = append(programs, washPrograms[name].info())
+		}
+		c.JSON(http.StatusOK, programs)
+	})
+
+	// Crea un trabajo de lavado y responde de inmediato con su ID
+	r.POST("/jobs", func(c *gin.Context) {
+		job, ok := startJob(c, c.Query("load"), c.Query("program"), c.Query("kg"), c.Query("strategy"))
+		if !ok {
+			return
 		}
 
-		if selectedWasher == nil {
-			c.JSON(http.StatusConflict, gin.H{"error": "No hay lavadoras disponibles"})
+		snapshot, _ := jobs.Get(job.ID)
+		c.JSON(http.StatusAccepted, snapshot)
+	})
+
+	// Consulta la etapa de un trabajo de lavado
+	r.GET("/jobs/:id", func(c *gin.Context) {
+		job, ok := jobs.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trabajo no encontrado"})
 			return
 		}
+		c.JSON(http.StatusOK, job)
+	})
 
-		// Crear un canal para notificar el fin del lavado
-		done := make(chan string)
+	// Aborta un trabajo en curso; la lavadora queda libre de inmediato
+	r.DELETE("/jobs/:id", func(c *gin.Context) {
+		found, aborted := jobs.Abort(c.Param("id"))
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trabajo no encontrado"})
+			return
+		}
+		job, _ := jobs.Get(c.Param("id"))
+		if !aborted {
+			c.JSON(http.StatusConflict, gin.H{"error": "El trabajo ya terminó", "job": job})
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	})
 
-		// Iniciar el lavado en una gorutina
-		go func() {
-			manageWashing(loadType, selectedWasher, c, done)
-		}()
+	// Versión síncrona: mantiene la petición abierta hasta que termine el ciclo.
+	// Se conserva por compatibilidad; los clientes nuevos deben usar /jobs.
+	r.GET("/start", func(c *gin.Context) {
+		job, ok := startJob(c, c.Query("load"), c.Query("program"), c.Query("kg"), c.Query("strategy"))
+		if !ok {
+			return
+		}
 
 		// Esperar a que se complete el ciclo de lavado
-		result := <-done
+		result, _ := jobs.Wait(job.ID)
+		if result.Phase == PhaseFailed {
+			c.JSON(http.StatusConflict, gin.H{"error": result.Error})
+			return
+		}
 
 		// Enviar respuesta HTTP con los detalles
 		c.JSON(http.StatusOK, gin.H{
-			"message": result,
+			"message": result.Message,
 			"details": gin.H{
-				"load_type": loadType,
-				"washer":    selectedWasher.name,
+				"load_type": result.LoadType,
+				"program":   result.Program,
+				"weight_kg": result.WeightKg,
+				"washer":    result.Washer,
+				"job_id":    result.ID,
+				"selection": result.Selection,
 			},
 		})
 	})
 
+	// Administración de la flota en tiempo de ejecución
+	admin := r.Group("/admin/washers")
+
+	admin.GET("/strategy", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"strategy": fleet.Strategy(), "strategies": strategies})
+	})
+
+	// Cambia la estrategia que se usa cuando la petición no indica una
+	admin.PUT("/strategy", func(c *gin.Context) {
+		var request struct {
+			Strategy SelectionStrategy `json:"strategy"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cuerpo inválido: %v", err)})
+			return
+		}
+		if err := fleet.SetStrategy(request.Strategy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "strategies": strategies})
+			return
+		}
+		fmt.Printf("Estrategia de selección: %s\n", request.Strategy)
+		c.JSON(http.StatusOK, gin.H{"strategy": fleet.Strategy(), "strategies": strategies})
+	})
+
+	admin.GET("", func(c *gin.Context) {
+		washers := fleet.All()
+		infos := make([]WasherInfo, len(washers))
+		for i, washer := range washers {
+			infos[i] = washer.info()
+		}
+		c.JSON(http.StatusOK, infos)
+	})
+
+	admin.POST("", func(c *gin.Context) {
+		var config WasherConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cuerpo inválido: %v", err)})
+			return
+		}
+		washer, err := fleet.Add(config)
+		if errors.Is(err, errWasherExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("Se agregó la lavadora %s a la flota\n", washer.name)
+		c.JSON(http.StatusCreated, washer.info())
+	})
+
+	admin.POST("/:name/retire", func(c *gin.Context) {
+		washer, err := fleet.Retire(c.Param("name"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("La lavadora %s fue retirada\n", washer.name)
+		c.JSON(http.StatusOK, washer.info())
+	})
+
+	admin.DELETE("/:name", func(c *gin.Context) {
+		err := fleet.Remove(c.Param("name"))
+		switch {
+		case errors.Is(err, errWasherNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, errWasherBusy):
+			c.JSON(http.StatusConflict, gin.H{"error": "La lavadora está lavando; retírela y elimínela cuando termine"})
+		default:
+			fmt.Printf("Se eliminó la lavadora %s de la flota\n", c.Param("name"))
+			c.Status(http.StatusNoContent)
+		}
+	})
+
 	r.Run(":4007")
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Etapas de un programa de lavado, en el orden en que se ejecutan
+const (
+	StagePrewash = "prewash"
+	StageWash    = "wash"
+	StageRinse   = "rinse"
+	StageSpin    = "spin"
+)
+
+// ProgramStage es una etapa de un programa: consume agua y energía al empezar y
+// luego ocupa la lavadora durante Duration
+type ProgramStage struct {
+	Name     string
+	Water    int
+	Energy   int
+	Duration time.Duration
+}
+
+// WashProgram es un programa de lavado con nombre
+type WashProgram struct {
+	Name   string
+	Stages []ProgramStage
+}
+
+// Totals devuelve el agua, la energía y el tiempo que consume el programa completo
+func (p WashProgram) Totals() (water int, energy int, duration time.Duration) {
+	for _, stage := range p.Stages {
+		water += stage.Water
+		energy += stage.Energy
+		duration += stage.Duration
+	}
+	return water, energy, duration
+}
+
+// Programas disponibles. delicate, cotton y heavy reemplazan a los tipos de carga
+// 1, 2 y 3: consumen lo mismo que antes (10, 20 y 30 de agua, 30 de energía) y
+// duran lo mismo que el ciclo único original de 3 segundos.
+var washPrograms = map[string]WashProgram{
+	"delicate": {Name: "delicate", Stages: []ProgramStage{
+		{Name: StageWash, Water: 5, Energy: 10, Duration: 1500 * time.Millisecond},
+		{Name: StageRinse, Water: 5, Energy: 10, Duration: 1000 * time.Millisecond},
+		{Name: StageSpin, Water: 0, Energy: 10, Duration: 500 * time.Millisecond},
+	}},
+	"cotton": {Name: "cotton", Stages: []ProgramStage{
+		{Name: StagePrewash, Water: 5, Energy: 5, Duration: 500 * time.Millisecond},
+		{Name: StageWash, Water: 10, Energy: 10, Duration: 1000 * time.Millisecond},
+		{Name: StageRinse, Water: 5, Energy: 5, Duration: 1000 * time.Millisecond},
+		{Name: StageSpin, Water: 0, Energy: 10, Duration: 500 * time.Millisecond},
+	}},
+	"heavy": {Name: "heavy", Stages: []ProgramStage{
+		{Name: StagePrewash, Water: 8, Energy: 5, Duration: 500 * time.Millisecond},
+		{Name: StageWash, Water: 12, Energy: 10, Duration: 1000 * time.Millisecond},
+		{Name: StageRinse, Water: 10, Energy: 5, Duration: 1000 * time.Millisecond},
+		{Name: StageSpin, Water: 0, Energy: 10, Duration: 500 * time.Millisecond},
+	}},
+	"quick": {Name: "quick", Stages: []ProgramStage{
+		{Name: StageWash, Water: 8, Energy: 10, Duration: 1000 * time.Millisecond},
+		{Name: StageRinse, Water: 4, Energy: 5, Duration: 500 * time.Millisecond},
+		{Name: StageSpin, Water: 0, Energy: 10, Duration: 500 * time.Millisecond},
+	}},
+	"eco": {Name: "eco", Stages: []ProgramStage{
+		{Name: StagePrewash, Water: 3, Energy: 3, Duration: 1000 * time.Millisecond},
+		{Name: StageWash, Water: 8, Energy: 6, Duration: 2500 * time.Millisecond},
+		{Name: StageRinse, Water: 5, Energy: 3, Duration: 1500 * time.Millisecond},
+		{Name: StageSpin, Water: 0, Energy: 6, Duration: 1000 * time.Millisecond},
+	}},
+}
+
+// programForLoad traduce los tipos de carga originales a un programa
+var programForLoad = map[int]string{
+	1: "delicate",
+	2: "cotton",
+	3: "heavy",
+}
+
+// programNames devuelve los nombres de todos los programas, ordenados
+func programNames() []string {
+	names := make([]string, 0, len(washPrograms))
+	for name := range washPrograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveProgram elige el programa de un trabajo. Si se indica el nombre tiene
+// preferencia; si no, se usa el programa asociado al tipo de carga.
+func resolveProgram(loadType int, name string) (WashProgram, error) {
+	if name == "" {
+		var ok bool
+		if name, ok = programForLoad[loadType]; !ok {
+			return WashProgram{}, fmt.Errorf("tipo de carga desconocido %d", loadType)
+		}
+	}
+	program, ok := washPrograms[name]
+	if !ok {
+		return WashProgram{}, fmt.Errorf("programa desconocido %q", name)
+	}
+	return program, nil
+}
+
+// StageInfo es la vista de una etapa en las respuestas JSON
+type StageInfo struct {
+	Name            string  `json:"name"`
+	Water           int     `json:"water"`
+	Energy          int     `json:"energy"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+func (s ProgramStage) info() StageInfo {
+	return StageInfo{Name: s.Name, Water: s.Water, Energy: s.Energy, DurationSeconds: s.Duration.Seconds()}
+}
+
+// ProgramInfo es la vista de un programa en GET /programs
+type ProgramInfo struct {
+	Name            string      `json:"name"`
+	Stages          []StageInfo `json:"stages"`
+	TotalWater      int         `json:"total_water"`
+	TotalEnergy     int         `json:"total_energy"`
+	DurationSeconds float64     `json:"duration_seconds"`
+}
+
+func (p WashProgram) info() ProgramInfo {
+	water, energy, duration := p.Totals()
+	stages := make([]StageInfo, len(p.Stages))
+	for i, stage := range p.Stages {
+		stages[i] = stage.info()
+	}
+	return ProgramInfo{Name: p.Name, Stages: stages, TotalWater: water, TotalEnergy: energy, DurationSeconds: duration.Seconds()}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+	"github.com/M1keTrike/LaundryAPI_Go/internal/stream"
+)
+
+const (
+	ResourceWaitTimeout = 15 * time.Second // Tiempo máximo que una etapa espera las recargas
+	RefillRetryDelay    = 1 * time.Second  // Pausa tras una recarga fallida o vacía antes de pedir otra
+)
+
+// Recursos que consume una lavadora
+const (
+	ResourceWater  = "water"
+	ResourceEnergy = "energy"
+)
+
+var (
+	errReservationAborted = errors.New("la reserva se canceló porque se abortó el trabajo")
+	errTankRefused        = errors.New("el tanque rechazó la reserva")
+)
+
+// ResourceError indica que una lavadora no consiguió reservar un recurso a tiempo.
+// Cause guarda el último error de recarga, si lo hubo.
+type ResourceError struct {
+	Washer    string
+	Resource  string
+	Needed    int
+	Available int
+	Cause     error
+}
+
+func (e *ResourceError) Error() string {
+	message := fmt.Sprintf("%s no consiguió %d unidades de %s (disponibles: %d)", e.Washer, e.Needed, e.Resource, e.Available)
+	if e.Cause != nil {
+		message += ": " + e.Cause.Error()
+	}
+	return message
+}
+
+func (e *ResourceError) Unwrap() error {
+	return e.Cause
+}
+
+// Reservation aparta agua y energía de una lavadora hasta que Commit los descuenta
+type Reservation struct {
+	washer *Washer
+	water  int
+	energy int
+	closed bool
+}
+
+// notifyLocked despierta a quienes esperan un cambio de niveles; requiere w.mu tomado
+func (w *Washer) notifyLocked() {
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// Reserve aparta los recursos de una etapa. Si no alcanzan, pide las recargas y
+// espera hasta timeout; abort permite cancelar la espera.
+func (w *Washer) Reserve(water, energy int, timeout time.Duration, abort <-chan struct{}) (*Reservation, error) {
+	deadline := clock.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		w.mu.Lock()
+		freeWater := w.waterLevel - w.reservedWater
+		freeEnergy := w.energyLevel - w.reservedEnergy
+		if freeWater >= water && freeEnergy >= energy {
+			w.reservedWater += water
+			w.reservedEnergy += energy
+			w.mu.Unlock()
+			return &Reservation{washer: w, water: water, energy: energy}, nil
+		}
+		w.startRefillsLocked()
+		changed := w.changed
+		shortage := &ResourceError{Washer: w.name, Resource: ResourceWater, Needed: water, Available: freeWater, Cause: w.waterRefillErr}
+		if freeWater >= water {
+			shortage = &ResourceError{Washer: w.name, Resource: ResourceEnergy, Needed: energy, Available: freeEnergy, Cause: w.energyRefillErr}
+		}
+		w.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-abort:
+			return nil, errReservationAborted
+		case <-deadline.C:
+			return nil, shortage
+		}
+	}
+}
+
+// Commit descuenta los recursos reservados y repone lo consumido en segundo plano
+func (r *Reservation) Commit() {
+	w := r.washer
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if r.closed {
+		return
+	}
+	r.closed = true
+	w.reservedWater -= r.water
+	w.reservedEnergy -= r.energy
+	w.waterLevel -= r.water
+	w.energyLevel -= r.energy
+	w.waterUsed += r.water
+	w.energyUsed += r.energy
+	fmt.Printf("%s utilizó %d unidades de agua y %d unidades de energía. Nivel restante de agua: %d, energía: %d\n", w.name, r.water, r.energy, w.waterLevel, w.energyLevel)
+	w.startRefillsLocked()
+}
+
+// startRefillsLocked pide agua al tanque y energía a cfe para llenar la lavadora,
+// sin lanzar una segunda recarga si ya hay una en curso; requiere w.mu tomado
+func (w *Washer) startRefillsLocked() {
+	if missing := w.maxWater - w.waterLevel; missing > 0 && !w.refillingWater {
+		w.refillingWater = true
+		// El tanque entrega bloques de 10 unidades; mientras quede agua reservada
+		// para el trabajo, la recarga sale de la reserva
+		url := TankServerSupply + strconv.Itoa((missing+9)/10)
+		w.refillReservation = ""
+		if w.tankReservation != "" && w.tankReserved > 0 {
+			w.refillReservation = w.tankReservation
+			url += "&reservation=" + w.tankReservation
+		}
+		ctx, cancel := context.WithCancel(w.ctx)
+		w.cancelWaterRefill = cancel
+		go w.refill(ctx, cancel, ResourceWater, url, http.MethodPost)
+	}
+	if missing := w.maxEnergy - w.energyLevel; missing > 0 && !w.refillingEnergy {
+		w.refillingEnergy = true
+		ctx, cancel := context.WithCancel(w.ctx)
+		w.cancelEnergyRefill = cancel
+		go w.refill(ctx, cancel, ResourceEnergy, EnergyServerSupply+strconv.Itoa(missing), http.MethodGet)
+	}
+}
+
+// stopRefillsLocked corta las recargas en curso; requiere w.mu tomado
+func (w *Washer) stopRefillsLocked() {
+	if w.refillingWater {
+		w.cancelWaterRefill()
+	}
+	if w.refillingEnergy {
+		w.cancelEnergyRefill()
+	}
+}
+
+// refill lee el flujo de bloques del proveedor y suma cada bloque al nivel del
+// recurso. Si el proveedor falla o no entrega nada, espera antes de permitir otra
+// recarga para no saturarlo mientras haya etapas esperando. Si se canceló ctx no
+// espera: la siguiente etapa que necesite el recurso pide otra recarga.
+func (w *Washer) refill(ctx context.Context, cancel context.CancelFunc, resource string, url string, method string) {
+	defer cancel()
+	summary, err := w.streamRefill(ctx, resource, url, method)
+	if err == nil && summary.Delivered == 0 {
+		err = fmt.Errorf("el proveedor no entregó %s (%s)", resource, summary.Reason)
+	}
+	if err != nil && ctx.Err() == nil {
+		clock.Sleep(RefillRetryDelay)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case err != nil && ctx.Err() != nil:
+		fmt.Printf("%s dejó de recargar %s: se canceló la recarga\n", w.name, resource)
+	case err != nil:
+		fmt.Printf("%s no pudo recargar %s: %v\n", w.name, resource, err)
+	}
+	if resource == ResourceWater {
+		// Si el tanque ya no acepta la reserva (venció o se agotó) se sigue sin ella
+		var statusErr *stream.StatusError
+		if w.refillReservation != "" && w.refillReservation == w.tankReservation && errors.As(err, &statusErr) {
+			w.tankReservation, w.tankReserved = "", 0
+		}
+		w.refillingWater = false
+		w.refillReservation = ""
+		w.waterRefillErr = err
+	} else {
+		w.refillingEnergy = false
+		w.energyRefillErr = err
+	}
+	// Lo consumido mientras llegaba la recarga se pide en una recarga nueva
+	if err == nil && ctx.Err() == nil {
+		w.startRefillsLocked()
+	}
+	w.notifyLocked()
+}
+
+// streamRefill suma al nivel del recurso cada bloque que llega y devuelve el
+// resumen del proveedor. La lavadora se identifica con su nombre para que el
+// tanque aplique su cuota y su prioridad.
+func (w *Washer) streamRefill(ctx context.Context, resource string, url string, method string) (stream.Summary, error) {
+	return stream.FetchAs(ctx, w.name, method, url, stream.Resource(resource), func(block stream.Block) error {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if resource == ResourceWater {
+			if w.refillReservation != "" && w.refillReservation == w.tankReservation {
+				w.tankReserved = max(w.tankReserved-block.Amount, 0)
+			}
+			w.waterLevel = min(w.waterLevel+block.Amount, w.maxWater)
+			fmt.Printf("%s recibió %d unidades de agua. Nivel actual: %d\n", w.name, block.Amount, w.waterLevel)
+		} else {
+			w.energyLevel = min(w.energyLevel+block.Amount, w.maxEnergy)
+			fmt.Printf("%s recibió %d unidades de energía. Nivel actual: %d\n", w.name, block.Amount, w.energyLevel)
+		}
+		w.notifyLocked()
+		return nil
+	})
+}
+
+// reserveTankWater pide al tanque que aparte water unidades durante ttl para las
+// recargas del trabajo. Devuelve un error si el tanque no tiene el agua o la
+// cuota de la lavadora no alcanza; si el tanque no responde se lava sin reserva.
+func (w *Washer) reserveTankWater(water int, ttl time.Duration) error {
+	if water <= 0 {
+		return nil
+	}
+	url := fmt.Sprintf("%s?quantity=%d&ttl=%s", TankReservations, water, ttl)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(stream.ConsumerHeader, w.name)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("No se pudo reservar agua para %s; se lava sin reserva: %v\n", w.name, err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		ID        string `json:"id"`
+		Remaining int    `json:"remaining"`
+		Error     string `json:"error"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&body)
+	switch {
+	case resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", errTankRefused, body.Error)
+	case resp.StatusCode != http.StatusCreated || decodeErr != nil:
+		fmt.Printf("El tanque no reservó agua para %s (%d); se lava sin reserva\n", w.name, resp.StatusCode)
+		return nil
+	}
+
+	w.mu.Lock()
+	w.tankReservation, w.tankReserved = body.ID, body.Remaining
+	w.mu.Unlock()
+	fmt.Printf("%s reservó %d unidades de agua en el tanque (%s)\n", w.name, body.Remaining, body.ID)
+	return nil
+}
+
+// transferTankReservation pasa a la lavadora to la reserva id que tenía from en el
+// tanque, para que el trabajo delegado conserve el agua apartada. Devuelve
+// errTankRefused si la cuota de to no alcanza; si la reserva ya se cerró o el
+// tanque no responde, to sigue sin reserva.
+func transferTankReservation(from string, to *Washer, id string) error {
+	url := fmt.Sprintf("%s/%s/transfer?to=%s", TankReservations, id, to.name)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(stream.ConsumerHeader, from)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("No se pudo pasar la reserva de agua %s a %s; sigue sin reserva: %v\n", id, to.name, err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Remaining int    `json:"remaining"`
+		Error     string `json:"error"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&body)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", errTankRefused, body.Error)
+	case resp.StatusCode != http.StatusOK || decodeErr != nil:
+		fmt.Printf("El tanque no pasó la reserva %s a %s (%d); sigue sin reserva\n", id, to.name, resp.StatusCode)
+		return nil
+	}
+
+	to.mu.Lock()
+	to.tankReservation, to.tankReserved = id, body.Remaining
+	to.mu.Unlock()
+	fmt.Printf("%s recibió de %s la reserva de agua %s (%d unidades)\n", to.name, from, id, body.Remaining)
+	return nil
+}
+
+// cancelTankReservation devuelve al tanque el agua que la lavadora no usó
+func cancelTankReservation(washer string, id string) {
+	req, err := http.NewRequest(http.MethodDelete, TankReservations+"/"+id, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set(stream.ConsumerHeader, washer)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("No se pudo cancelar la reserva de agua %s de %s: %v\n", id, washer, err)
+		return
+	}
+	resp.Body.Close()
+}
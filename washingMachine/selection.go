@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SelectionStrategy decide qué lavadora libre recibe un trabajo
+type SelectionStrategy string
+
+const (
+	StrategyRoundRobin    SelectionStrategy = "round_robin"    // Turno rotativo entre las lavadoras
+	StrategyLeastUsed     SelectionStrategy = "least_used"     // La que completó menos ciclos
+	StrategyMostResources SelectionStrategy = "most_resources" // La que tiene más agua y energía libres
+	StrategyEnergyAware   SelectionStrategy = "energy_aware"   // La que cubre la energía del programa con el menor sobrante
+
+	DefaultStrategy = StrategyRoundRobin
+)
+
+var strategies = []SelectionStrategy{StrategyRoundRobin, StrategyLeastUsed, StrategyMostResources, StrategyEnergyAware}
+
+func validStrategy(strategy SelectionStrategy) bool {
+	for _, known := range strategies {
+		if known == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// Selection explica por qué se eligió la lavadora de un trabajo
+type Selection struct {
+	Strategy   SelectionStrategy `json:"strategy"`
+	Washer     string            `json:"washer"`
+	Reason     string            `json:"reason"`
+	Candidates int               `json:"candidates"` // Lavadoras libres que admitían el programa y la carga
+}
+
+// candidate es una foto de una lavadora libre al momento de elegir
+type candidate struct {
+	washer     *Washer
+	position   int // Posición en la flota, para el turno rotativo y los desempates
+	cycles     int
+	freeWater  int
+	freeEnergy int
+}
+
+// candidates devuelve las lavadoras libres, activas y en servicio que admiten el
+// programa y la carga en kg (cero si no se indicó), sin las excluidas, en el orden
+// de la flota
+func (f *Fleet) candidates(program string, weightKg float64, exclude []*Washer) []candidate {
+	var found []candidate
+	for position, washer := range f.All() {
+		skip := false
+		for _, excluded := range exclude {
+			if washer == excluded {
+				skip = true
+				break
+			}
+		}
+		if skip || !washer.supports(program) || weightKg > washer.capacityKg {
+			continue
+		}
+
+		washer.mu.Lock()
+		if !washer.busy && !washer.retired && washer.operationalLocked() {
+			found = append(found, candidate{
+				washer:     washer,
+				position:   position,
+				cycles:     washer.cycles,
+				freeWater:  washer.waterLevel - washer.reservedWater,
+				freeEnergy: washer.energyLevel - washer.reservedEnergy,
+			})
+		}
+		washer.mu.Unlock()
+	}
+	return found
+}
+
+// choose aplica la estrategia a las candidatas; devuelve la elegida y el motivo
+func (f *Fleet) choose(strategy SelectionStrategy, candidates []candidate, program WashProgram) (candidate, string) {
+	switch strategy {
+	case StrategyLeastUsed:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].cycles < candidates[j].cycles
+		})
+		chosen := candidates[0]
+		return chosen, fmt.Sprintf("%s es la que menos ciclos completó (%d)", chosen.washer.name, chosen.cycles)
+
+	case StrategyMostResources:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].freeWater+candidates[i].freeEnergy > candidates[j].freeWater+candidates[j].freeEnergy
+		})
+		chosen := candidates[0]
+		return chosen, fmt.Sprintf("%s es la que tiene más recursos libres: %d de agua y %d de energía", chosen.washer.name, chosen.freeWater, chosen.freeEnergy)
+
+	case StrategyEnergyAware:
+		// Las que cubren el programa sin pedir energía a cfe van primero; entre
+		// ellas, la de menor sobrante, para dejar las más cargadas a programas pesados
+		_, needed, _ := program.Totals()
+		sort.SliceStable(candidates, func(i, j int) bool {
+			iCovers, jCovers := candidates[i].freeEnergy >= needed, candidates[j].freeEnergy >= needed
+			if iCovers != jCovers {
+				return iCovers
+			}
+			if iCovers {
+				return candidates[i].freeEnergy < candidates[j].freeEnergy
+			}
+			return candidates[i].freeEnergy > candidates[j].freeEnergy
+		})
+		chosen := candidates[0]
+		if chosen.freeEnergy >= needed {
+			return chosen, fmt.Sprintf("%s cubre los %d de energía del programa con el menor sobrante (%d libres)", chosen.washer.name, needed, chosen.freeEnergy)
+		}
+		return chosen, fmt.Sprintf("Ninguna lavadora cubre los %d de energía del programa; %s es la que tiene más (%d libres)", needed, chosen.washer.name, chosen.freeEnergy)
+	}
+
+	// Turno rotativo: la primera candidata a partir de la posición siguiente a la última elegida
+	f.mu.Lock()
+	next := f.nextTurn
+	f.mu.Unlock()
+	chosen := candidates[0]
+	for _, c := range candidates {
+		if c.position >= next {
+			chosen = c
+			break
+		}
+	}
+	return chosen, fmt.Sprintf("%s es la siguiente lavadora libre en el turno rotativo", chosen.washer.name)
+}
+
+// Reserve elige con la estrategia indicada (o la de la flota si viene vacía) una
+// lavadora libre que admita el programa y los kg de la carga, sin considerar las
+// excluidas, y la marca como ocupada. Devuelve nil si no hay ninguna.
+func (f *Fleet) Reserve(program WashProgram, weightKg float64, strategy SelectionStrategy, exclude ...*Washer) (*Washer, Selection) {
+	if strategy == "" {
+		strategy = f.Strategy()
+	}
+	for {
+		candidates := f.candidates(program.Name, weightKg, exclude)
+		if len(candidates) == 0 {
+			return nil, Selection{}
+		}
+		total := len(candidates)
+		chosen, reason := f.choose(strategy, candidates, program)
+
+		washer := chosen.washer
+		washer.mu.Lock()
+		if washer.busy || washer.retired || !washer.operationalLocked() {
+			// Otra petición la tomó mientras se elegía; volver a elegir entre las que quedan
+			washer.mu.Unlock()
+			continue
+		}
+		washer.busy = true
+		washer.mu.Unlock()
+
+		if strategy == StrategyRoundRobin {
+			f.mu.Lock()
+			f.nextTurn = chosen.position + 1
+			f.mu.Unlock()
+		}
+		return washer, Selection{Strategy: strategy, Washer: washer.name, Reason: reason, Candidates: total}
+	}
+}
+
+// Strategy devuelve la estrategia que se usa cuando la petición no indica una
+func (f *Fleet) Strategy() SelectionStrategy {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.strategy
+}
+
+// SetStrategy cambia la estrategia por defecto de la flota
+func (f *Fleet) SetStrategy(strategy SelectionStrategy) error {
+	if !validStrategy(strategy) {
+		return fmt.Errorf("estrategia desconocida %q", strategy)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.strategy = strategy
+	return nil
+}
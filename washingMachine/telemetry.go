@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/M1keTrike/LaundryAPI_Go/internal/clock"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DefaultTelemetryInterval = 1 * time.Second
+	MinTelemetryInterval     = 100 * time.Millisecond
+	MaxTelemetryInterval     = 1 * time.Minute
+)
+
+// WasherStatus es el estado en vivo de una lavadora
+type WasherStatus struct {
+	Name           string      `json:"name"`
+	WaterLevel     int         `json:"water_level"`
+	MaxWater       int         `json:"max_water"`
+	EnergyLevel    int         `json:"energy_level"`
+	MaxEnergy      int         `json:"max_energy"`
+	CapacityKg     float64     `json:"capacity_kg"`
+	ReservedWater  int         `json:"reserved_water"`
+	ReservedEnergy int         `json:"reserved_energy"`
+	TankReserved   int         `json:"tank_reserved_water,omitempty"` // Agua que aún guarda el tanque para el trabajo
+	Refilling      []string    `json:"refilling,omitempty"`
+	State          WasherState `json:"state"`
+	Fault          FaultKind   `json:"fault,omitempty"`
+	Busy           bool        `json:"busy"`
+	Retired        bool        `json:"retired"`
+	CurrentJob     string      `json:"current_job,omitempty"`
+	Cycles         int         `json:"cycles"`
+	WaterUsed      int         `json:"water_used"`
+	EnergyUsed     int         `json:"energy_used"`
+	Programs       []string    `json:"programs"`
+	Reliability    Reliability `json:"reliability"`
+}
+
+func (w *Washer) status() WasherStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := WasherStatus{
+		Name:           w.name,
+		WaterLevel:     w.waterLevel,
+		MaxWater:       w.maxWater,
+		EnergyLevel:    w.energyLevel,
+		MaxEnergy:      w.maxEnergy,
+		CapacityKg:     w.capacityKg,
+		ReservedWater:  w.reservedWater,
+		ReservedEnergy: w.reservedEnergy,
+		TankReserved:   w.tankReserved,
+		State:          w.state,
+		Fault:          w.fault,
+		Busy:           w.busy,
+		Retired:        w.retired,
+		CurrentJob:     w.currentJob,
+		Cycles:         w.cycles,
+		WaterUsed:      w.waterUsed,
+		EnergyUsed:     w.energyUsed,
+		Programs:       w.programs,
+		Reliability:    w.reliabilityLocked(),
+	}
+	if w.refillingWater {
+		status.Refilling = append(status.Refilling, ResourceWater)
+	}
+	if w.refillingEnergy {
+		status.Refilling = append(status.Refilling, ResourceEnergy)
+	}
+	return status
+}
+
+// fleetStatus devuelve el estado de todas las lavadoras
+func fleetStatus() []WasherStatus {
+	washers := fleet.All()
+	statuses := make([]WasherStatus, len(washers))
+	for i, washer := range washers {
+		statuses[i] = washer.status()
+	}
+	return statuses
+}
+
+// TelemetrySample es una muestra del flujo de telemetría
+type TelemetrySample struct {
+	Seq       uint64         `json:"seq"`
+	Timestamp time.Time      `json:"timestamp"`
+	Washers   []WasherStatus `json:"washers"`
+}
+
+// telemetryHandler atiende GET /washers/telemetry. Envía por SSE una muestra del
+// estado de la flota cada intervalo (parámetro 'interval', por defecto 1s) hasta
+// que el cliente se desconecte.
+func telemetryHandler(c *gin.Context) {
+	interval := DefaultTelemetryInterval
+	if value := c.Query("interval"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < MinTelemetryInterval || parsed > MaxTelemetryInterval {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'interval' debe ser una duración entre 100ms y 1m"})
+			return
+		}
+		interval = parsed
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var seq uint64
+	send := func() {
+		seq++
+		c.Render(-1, sse.Event{
+			Id:    strconv.FormatUint(seq, 10),
+			Event: "telemetry",
+			Data:  TelemetrySample{Seq: seq, Timestamp: clock.Now(), Washers: fleetStatus()},
+		})
+	}
+
+	// La primera muestra sale de inmediato para no esperar un intervalo completo
+	send()
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			send()
+			return true
+		}
+	})
+}